@@ -3,6 +3,8 @@ package main
 import (
 	"TeleBotNotifications/internal/app"
 	"time"
+	// Timezones of users don't depend on zoneinfo of the image
+	_ "time/tzdata"
 )
 
 func main() {
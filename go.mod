@@ -1,3 +1,3 @@
 module TeleBotNotifications
 
-go 1.20
\ No newline at end of file
+go 1.21
\ No newline at end of file
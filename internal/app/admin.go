@@ -0,0 +1,235 @@
+package app
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"TeleBotNotifications/internal/telegram"
+)
+
+const apiDateFormat = "2006-01-02"
+
+// Default number of history entries returned by the admin API
+const defaultAPILimit = 50
+
+type apiUser struct {
+	UserId       int       `json:"user_id"`
+	ChatId       int       `json:"chat_id"`
+	LastCheck    time.Time `json:"last_check"`
+	Scope        string    `json:"scope"`
+	TokenExpires time.Time `json:"token_expires"`
+	Refreshable  bool      `json:"refreshable"`
+	Checking     bool      `json:"checking"`
+}
+
+type apiCheckRequest struct {
+	UserId int    `json:"user_id"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// adminAPI serves the JSON API for scripts. Every request must carry the
+// admin token as a bearer token
+//
+//	GET    /api/users
+//	POST   /api/users/{id}/test-notification
+//	GET    /api/checks?user_id=&limit=
+//	POST   /api/checks                        {"user_id", "from", "to"}
+//	DELETE /api/checks/{id}
+//	GET    /api/notifications?user_id=&limit=
+func (s *Server) adminAPI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Admin.Token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, apiError{Error: "invalid token"})
+			return
+		}
+
+		path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/"), "/"), "/")
+		switch {
+		case len(path) == 1 && path[0] == "users" && r.Method == http.MethodGet:
+			s.apiUsers(w, r)
+		case len(path) == 3 && path[0] == "users" && path[2] == "test-notification" && r.Method == http.MethodPost:
+			s.apiTestNotification(w, r, path[1])
+		case len(path) == 1 && path[0] == "checks" && r.Method == http.MethodGet:
+			s.apiChecks(w, r)
+		case len(path) == 1 && path[0] == "checks" && r.Method == http.MethodPost:
+			s.apiStartCheck(w, r)
+		case len(path) == 2 && path[0] == "checks" && r.Method == http.MethodDelete:
+			s.apiCancelCheck(w, r, path[1])
+		case len(path) == 1 && path[0] == "notifications" && r.Method == http.MethodGet:
+			s.apiNotifications(w, r)
+		default:
+			writeJSON(w, http.StatusNotFound, apiError{Error: "not found"})
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("api response write failed", "error", err)
+	}
+}
+
+// writeAPIError reports user errors as client errors and hides the rest
+func writeAPIError(w http.ResponseWriter, err error) {
+	var userError *telegram.UserError
+	switch {
+	case errors.Is(err, errNoUser):
+		writeJSON(w, http.StatusNotFound, apiError{Error: "user not found"})
+	case errors.Is(err, errCheckRunning):
+		writeJSON(w, http.StatusConflict, apiError{Error: err.Error()})
+	case errors.As(err, &userError):
+		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+	default:
+		slog.Error("api request failed", "error", err)
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "internal error"})
+	}
+}
+
+// queryInt returns the query parameter or def if it is not set
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		return 0, telegram.NewUserError("%s must be a non-negative number", name)
+	}
+	return number, nil
+}
+
+// historyQuery reads the user and the number of entries to return
+func historyQuery(r *http.Request) (userId, limit int, err error) {
+	userId, err = queryInt(r, "user_id", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	limit, err = queryInt(r, "limit", defaultAPILimit)
+	if err != nil {
+		return 0, 0, err
+	}
+	return userId, limit, nil
+}
+
+// parseAPIDate reads a date in the timezone of the user
+func parseAPIDate(name, value string, location *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.ParseInLocation(apiDateFormat, value, location)
+	if err != nil {
+		return time.Time{}, telegram.NewUserError("%s must be a date in format %s", name, apiDateFormat)
+	}
+	return date, nil
+}
+
+func (s *Server) apiUsers(w http.ResponseWriter, _ *http.Request) {
+	users := s.db.Users()
+	result := make([]apiUser, 0, len(users))
+	for _, user := range users {
+		result = append(result, apiUser{
+			UserId:       user.UserId,
+			ChatId:       user.ChatId,
+			LastCheck:    user.LastCheck,
+			Scope:        user.Token.Scope,
+			TokenExpires: user.Token.Expires,
+			Refreshable:  user.Token.RefreshToken != "",
+			Checking:     s.checkRunning(user.UserId),
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) apiTestNotification(w http.ResponseWriter, _ *http.Request, id string) {
+	userId, err := strconv.Atoi(id)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "user not found"})
+		return
+	}
+	message, err := s.SendTestNotification(userId)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"message_id": message.MessageId})
+}
+
+func (s *Server) apiChecks(w http.ResponseWriter, r *http.Request) {
+	userId, limit, err := historyQuery(r)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.db.Checks(userId, limit))
+}
+
+// apiStartCheck starts a check as /check does. Empty from continues from the
+// last check of the user and empty to means today. Both dates are checked, so
+// the same from and to check one day
+func (s *Server) apiStartCheck(w http.ResponseWriter, r *http.Request) {
+	request := apiCheckRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeAPIError(w, telegram.NewUserError("Wrong request body: %s", err))
+		return
+	}
+	user := s.db.Get(request.UserId)
+	if user == nil {
+		writeAPIError(w, errNoUser)
+		return
+	}
+	location := user.Settings.Location()
+	from, err := parseAPIDate("from", request.From, location)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	to, err := parseAPIDate("to", request.To, location)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	check, err := s.CheckNewReleases(CheckRequest{
+		UserId:  request.UserId,
+		From:    from,
+		To:      to,
+		Trigger: TriggerAPI,
+	})
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, check)
+}
+
+func (s *Server) apiCancelCheck(w http.ResponseWriter, _ *http.Request, checkId string) {
+	if !s.CancelCheck(checkId) {
+		writeJSON(w, http.StatusNotFound, apiError{Error: fmt.Sprintf("check %s is not running", checkId)})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"canceled": checkId})
+}
+
+func (s *Server) apiNotifications(w http.ResponseWriter, r *http.Request) {
+	userId, limit, err := historyQuery(r)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.db.Notifications(userId, limit))
+}
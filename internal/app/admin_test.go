@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"TeleBotNotifications/internal/config"
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/scheduler"
+	"TeleBotNotifications/internal/spotify"
+)
+
+func newTestServer(t *testing.T) *Server {
+	s := &Server{
+		db:            db.NewDB(filepath.Join(t.TempDir(), "save.json")),
+		config:        &config.Config{Admin: config.AdminConfig{Token: "secret"}},
+		health:        newHealth(),
+		web:           newWebSessions(),
+		artists:       newArtistCache(),
+		runningChecks: make(map[string]runningCheck),
+		scheduler:     scheduler.New(nil, 0),
+	}
+	s.defaultSchedule, _ = scheduler.Parse("@daily")
+	s.db.Set(db.User{UserId: 1, ChatId: 10, LastCheck: time.Now()})
+	s.db.Set(db.User{UserId: 2, ChatId: 20, LastCheck: time.Now()})
+	s.db.SaveCheck(db.CheckRecord{Id: "a", UserId: 1, Status: db.CheckOk})
+	s.db.SaveCheck(db.CheckRecord{Id: "b", UserId: 2, Status: db.CheckFailed})
+	s.db.SaveCheck(db.CheckRecord{Id: "c", UserId: 1, Status: db.CheckRunning})
+	return s
+}
+
+func Test_adminAPI(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		token      string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "no token", method: http.MethodGet, path: "/api/users", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodGet, path: "/api/users", token: "secreT", wantStatus: http.StatusUnauthorized},
+		{name: "users", method: http.MethodGet, path: "/api/users", token: "secret", wantStatus: http.StatusOK, wantBody: `"user_id":2`},
+		{name: "checks of user", method: http.MethodGet, path: "/api/checks?user_id=1&limit=1", token: "secret", wantStatus: http.StatusOK, wantBody: `[{"id":"c"`},
+		{name: "wrong limit", method: http.MethodGet, path: "/api/checks?limit=x", token: "secret", wantStatus: http.StatusBadRequest},
+		{name: "notifications", method: http.MethodGet, path: "/api/notifications", token: "secret", wantStatus: http.StatusOK, wantBody: `[]`},
+		{name: "check unknown user", method: http.MethodPost, path: "/api/checks", body: `{"user_id":3}`, token: "secret", wantStatus: http.StatusNotFound},
+		{name: "check wrong date", method: http.MethodPost, path: "/api/checks", body: `{"user_id":1,"from":"01.01.2024"}`, token: "secret", wantStatus: http.StatusBadRequest},
+		{name: "check empty period", method: http.MethodPost, path: "/api/checks", body: `{"user_id":1}`, token: "secret", wantStatus: http.StatusBadRequest},
+		{name: "cancel not running", method: http.MethodDelete, path: "/api/checks/c", token: "secret", wantStatus: http.StatusNotFound},
+		{name: "unknown route", method: http.MethodPut, path: "/api/users", token: "secret", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			request := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				request.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			recorder := httptest.NewRecorder()
+			s.adminAPI().ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("adminAPI() status = %d, want %d, body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if !json.Valid(recorder.Body.Bytes()) {
+				t.Errorf("adminAPI() body is not JSON: %s", recorder.Body)
+			}
+			if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("adminAPI() body = %s, want it to contain %s", recorder.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func Test_CancelCheck(t *testing.T) {
+	s := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.trackCheck(db.CheckRecord{Id: "c", UserId: 1}, cancel)
+
+	request := httptest.NewRequest(http.MethodDelete, "/api/checks/c", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder := httptest.NewRecorder()
+	s.adminAPI().ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("adminAPI() status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	if ctx.Err() == nil {
+		t.Errorf("check context is not canceled")
+	}
+}
+
+func Test_apiStartCheck(t *testing.T) {
+	// Spotify rejects the token, so the check fails right after it starts
+	transport := http.DefaultTransport
+	http.DefaultTransport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusUnauthorized,
+			Body:       io.NopCloser(strings.NewReader(`{"error": {"status": 401, "message": "Invalid access token"}}`)),
+			Request:    r,
+		}, nil
+	})
+	defer func() { http.DefaultTransport = transport }()
+
+	s := newTestServer(t)
+	var err error
+	s.spotifyClient, err = spotify.NewClient(&config.SpotifyConfig{ClientId: "id", ClientSecret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.db.Update(1, func(user *db.User) {
+		user.Token.Expires = time.Now().Add(time.Hour)
+	})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/api/checks", strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer secret")
+		recorder := httptest.NewRecorder()
+		s.adminAPI().ServeHTTP(recorder, request)
+		s.wg.Wait()
+		return recorder
+	}
+
+	// A single day is a valid range, a reversed one is not
+	if recorder := post(`{"user_id":1,"from":"2024-01-01","to":"2024-01-01"}`); recorder.Code != http.StatusAccepted {
+		t.Errorf("single day check status = %d, body %s", recorder.Code, recorder.Body)
+	}
+	if recorder := post(`{"user_id":1,"from":"2024-01-02","to":"2024-01-01"}`); recorder.Code != http.StatusBadRequest {
+		t.Errorf("reversed period status = %d, body %s", recorder.Code, recorder.Body)
+	}
+
+	recorder := post(`{"user_id":1,"from":"2024-01-01"}`)
+
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("adminAPI() status = %d, want %d, body %s", recorder.Code, http.StatusAccepted, recorder.Body)
+	}
+	var started db.CheckRecord
+	if err := json.Unmarshal(recorder.Body.Bytes(), &started); err != nil {
+		t.Fatalf("adminAPI() body = %s: %v", recorder.Body, err)
+	}
+	if started.Status != db.CheckRunning || started.UserId != 1 {
+		t.Errorf("started check = %+v", started)
+	}
+	if checks := s.db.Checks(1, 1); len(checks) != 1 || checks[0].Id != started.Id || checks[0].Status != db.CheckFailed {
+		t.Errorf("finished check = %+v", checks)
+	}
+}
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/url"
 	"strconv"
 	"strings"
@@ -13,67 +14,73 @@ import (
 	"TeleBotNotifications/internal/logger"
 	"TeleBotNotifications/internal/spotify"
 	"TeleBotNotifications/internal/telegram"
+	"TeleBotNotifications/internal/telegram/format"
 )
 
-func (s *Server) Greet(message telegram.ReceivedMessage) {
+func (s *Server) Greet(message telegram.ReceivedMessage) error {
 	authUrl, err := s.spotifyClient.GenerateAuthUrl()
 	if err != nil {
-		logger.Error.Println("error generating auth url: ", err)
-		return
+		return fmt.Errorf("error generating auth url: %w", err)
 	}
-	text := "Press button below to start authentication. Then use \"/auth <URL>\" with URL you were redirected"
-	err = s.bot.SendMessage(telegram.BotMessage{
-		Text:        text,
-		ReplyMarkup: telegram.ButtonRow(telegram.URLButton("Authenticate", *authUrl))})
+	text := format.New(format.MarkdownV2).
+		Text("Press button below to start authentication. Then use ").
+		Code("/auth <URL>").
+		Text(" with URL you were redirected")
+	reply := telegram.FormattedMessage(text)
+	reply.ChatId = message.ChatId
+	reply.ReplyMarkup = telegram.ButtonRow(telegram.URLButton("Authenticate", *authUrl))
+	_, err = s.bot.SendMessage(reply)
 	if err != nil {
-		logger.Error.Println("error sending auth url: ", err)
-		return
+		return fmt.Errorf("error sending auth url: %w", err)
 	}
+	return nil
 }
 
-func (s *Server) GetCodeFromUrl(message telegram.ReceivedMessage) {
+func (s *Server) GetCodeFromUrl(message telegram.ReceivedMessage) error {
 	parsedURL, err := url.Parse(message.Text)
 	if err != nil {
-		logger.Error.Println("error parsing URL: ", err)
-		return
+		return telegram.NewUserError("Can't parse URL: %s", err)
 	}
 	code := parsedURL.Query().Get("code")
 	if code == "" {
-		logger.Error.Println("couldn't extract code from url: ", message.Text)
-		return
+		return telegram.NewUserError("Couldn't extract code from URL %s", message.Text)
 	}
 
 	token, err := s.spotifyClient.RequestAccessToken(&code)
 	if err != nil {
-		logger.Error.Println("error requesting token: ", err)
-		return
+		return fmt.Errorf("error requesting token: %w", err)
 	}
 
-	user := db.User{
-		UserId:    message.UserId,
-		ChatId:    message.ChatId,
-		Token:     *token,
-		LastCheck: time.Now(),
+	// Reauthentication keeps the rest of the user data
+	known := s.db.Update(message.UserId, func(user *db.User) {
+		user.ChatId = message.ChatId
+		user.Token = *token
+	})
+	if !known {
+		s.db.Set(db.User{
+			UserId:    message.UserId,
+			ChatId:    message.ChatId,
+			Token:     *token,
+			LastCheck: time.Now(),
+		})
 	}
-
-	s.db.Set(user)
 	err = s.db.Save()
 	if err != nil {
-		logger.Error.Println("db save failed:", err)
+		slog.Error("db save failed", "error", err)
 	}
+	s.scheduleUser(message.UserId)
 
-	text := "Successfull authentication"
-	err = s.bot.SendMessage(telegram.BotMessage{
-		Text: text,
-	})
+	reply := telegram.FormattedMessage(format.New(format.MarkdownV2).Bold("Successfull authentication"))
+	reply.ChatId = message.ChatId
+	_, err = s.bot.SendMessage(reply)
 	if err != nil {
-		logger.Error.Println("error sending auth response: ", err)
-		return
+		return fmt.Errorf("error sending auth response: %w", err)
 	}
-	logger.General.Printf("New user %d added\n", user.UserId)
+	slog.Info("user authenticated", "user_id", message.UserId, "new", !known)
+	return nil
 }
 
-func (s *Server) ForceCheck(message telegram.ReceivedMessage) {
+func (s *Server) ForceCheck(message telegram.ReceivedMessage) error {
 	var days int
 	var err error
 	if message.Text == "" {
@@ -82,147 +89,393 @@ func (s *Server) ForceCheck(message telegram.ReceivedMessage) {
 	} else {
 		days, err = strconv.Atoi(strings.TrimSpace(message.Text))
 	}
-	
+
 	if err != nil || days < 0 {
-		err = s.bot.SendMessage(telegram.BotMessage{
-			Text: "Wrong command parameter. It must be a positive number",
-		})
-		if err != nil {
-			logger.Error.Println("error sending auth response: ", err)
-		}
-		return
+		return telegram.NewUserError("Wrong command parameter. It must be a positive number")
 	}
 
-	if s.cancelSpotifyCheck != nil {
-		s.cancelSpotifyCheck()
-	}
+	_, err = s.CheckNewReleases(CheckRequest{
+		UserId:        message.UserId,
+		From:          time.Now().AddDate(0, 0, -days),
+		Trigger:       TriggerCommand,
+		Notifications: true,
+	})
+	return err
+}
 
-	offset := time.Duration(days) * 24 * time.Hour
-	s.CheckNewReleases(&offset, true)
+// stripTime returns the date of t in the location as midnight UTC, the form
+// of release dates
+func stripTime(t time.Time, location *time.Location) time.Time {
+	year, month, day := t.In(location).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
 }
 
-func stripTime(t time.Time) time.Time {
-	year, month, day := t.Date()
-	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+const (
+	TriggerSchedule = "schedule"
+	TriggerCommand  = "command"
+	TriggerAPI      = "api"
+)
+
+var errNoUser = &telegram.UserError{Message: "No spotify account authorized. Use /start first"}
+var errEmptyPeriod = &telegram.UserError{Message: "Nothing to check, the period is shorter than a day"}
+var errReversedPeriod = &telegram.UserError{Message: "The end of the period is before its start"}
+var errCheckRunning = &telegram.UserError{Message: "A check is already running"}
+
+// CheckRequest describes a check for new releases. Zero From continues from
+// the last check of the user, zero To means now. A given To is a date checked
+// too, so From and To of the same day check that day
+type CheckRequest struct {
+	UserId        int
+	From          time.Time
+	To            time.Time
+	Trigger       string
+	Notifications bool
 }
 
-func (s *Server) CheckNewReleases(offset *time.Duration, notifications bool) {
-	user := s.db.Get()
-	rangeEnd := time.Now()
-	rangeEndDate := stripTime(rangeEnd)
-	var rangeStart time.Time
-	if offset == nil {
+// CheckNewReleases starts a check in the background and returns its history
+// entry. Scheduled checks are skipped while the user has a running check,
+// other checks cancel it
+func (s *Server) CheckNewReleases(request CheckRequest) (*db.CheckRecord, error) {
+	user := s.db.Get(request.UserId)
+	if user == nil {
+		return nil, errNoUser
+	}
+	rangeEnd := request.To
+	if rangeEnd.IsZero() {
+		rangeEnd = time.Now()
+	}
+	rangeStart := request.From
+	if rangeStart.IsZero() {
 		rangeStart = user.LastCheck
+	}
+	location := user.Settings.Location()
+	rangeStartDate, rangeEndDate := stripTime(rangeStart, location), stripTime(rangeEnd, location)
+	switch {
+	case rangeEndDate.Before(rangeStartDate):
+		return nil, errReversedPeriod
+	case request.To.IsZero() && !rangeEndDate.After(rangeStartDate):
+		return nil, errEmptyPeriod
+	}
+
+	if request.Trigger == TriggerSchedule {
+		if s.checkRunning(user.UserId) {
+			return nil, errCheckRunning
+		}
 	} else {
-		rangeStart = rangeEnd.Add(-*offset)
+		s.cancelUserChecks(user.UserId)
 	}
-	rangeStartDate := stripTime(rangeStart)
-	if !rangeEndDate.After(rangeStartDate) {
-		return
+
+	started := time.Now()
+	check := db.CheckRecord{
+		Id:      strconv.FormatInt(started.UnixNano(), 36),
+		UserId:  user.UserId,
+		Trigger: request.Trigger,
+		From:    rangeStartDate,
+		To:      rangeEndDate,
+		Started: started,
+		Status:  db.CheckRunning,
 	}
+	s.db.SaveCheck(check)
 
 	// Create context for premature stop
 	spotifyContext, cancel := context.WithCancel(context.Background())
-	s.cancelSpotifyCheck = cancel
+	s.trackCheck(check, cancel)
+	spotifyContext = logger.With(spotifyContext, "check_id", check.Id, "user_id", user.UserId)
 
+	// The goroutine keeps changing its check, callers get the state at start
+	record := check
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
-		user.LastCheck = rangeEnd
-		s.db.Set(*user)
+		defer s.untrackCheck(check.Id)
+		defer cancel()
+
+		s.db.Update(user.UserId, func(u *db.User) {
+			if rangeEnd.After(u.LastCheck) {
+				u.LastCheck = rangeEnd
+			}
+		})
+		defer func() {
+			check.Finished = time.Now()
+			s.db.SaveCheck(check)
+			err := s.db.Save()
+			if err != nil {
+				slog.Error("db save failed", "error", err)
+			}
+		}()
 
-		message:=fmt.Sprintf("Checking for new releases. From %s to %s", rangeStartDate.Format("2006-01-02"), rangeEndDate.Format("2006-01-02"))
-		logger.General.Println(message)
-		if notifications {
-			s.bot.SendMessage(telegram.BotMessage{Text: message})
+		from, to := rangeStartDate.Format("2006-01-02"), rangeEndDate.Format("2006-01-02")
+		slog.InfoContext(spotifyContext, "checking for new releases", "from", from, "to", to, "trigger", request.Trigger)
+		if request.Notifications {
+			message := telegram.FormattedMessage(format.New(format.MarkdownV2).
+				Text("Checking for new releases. From ").Bold(from).Text(" to ").Bold(to))
+			message.ChatId = user.ChatId
+			s.bot.SendMessage(message)
 		}
 
-		newAlbums, err := s.spotifyClient.GetNewReleases(user.Token, rangeStartDate, rangeEndDate, spotifyContext)
+		newAlbums, err := s.spotifyClient.GetNewReleases(user.Token, user.Settings.IncludeGroups, rangeStartDate, rangeEndDate, spotifyContext)
+		checkDuration.Observe(time.Since(started).Seconds())
 		if err != nil {
 			if errors.Is(err, context.Canceled) {
-				// TODO: maybe print something in general log before death
+				checksTotal.Inc("canceled")
+				check.Status = db.CheckCanceled
+				slog.InfoContext(spotifyContext, "check canceled")
 				return
 			}
-			logger.Error.Println("Failed to get new releases with error:", err)
+			checksTotal.Inc("error")
+			check.Status = db.CheckFailed
+			check.Error = err.Error()
+			slog.ErrorContext(spotifyContext, "failed to get new releases", "error", err)
 			return
 		}
+		checksTotal.Inc("ok")
+		s.health.checked(rangeEnd)
+		releasesFoundTotal.Add(float64(len(newAlbums)))
+		// Settings could be changed while the check was running
+		if current := s.db.Get(user.UserId); current != nil {
+			user = current
+		}
+		newAlbums, check.Filtered = filterAlbums(user.Settings, titleRules(user.Settings), newAlbums, s.trackTitles(spotifyContext, user))
+		check.Status = db.CheckOk
+		check.Releases = len(newAlbums)
 
-		message = fmt.Sprintf("Found %d new releases", len(newAlbums))
-		logger.General.Println(message)
-		if notifications && len(newAlbums) == 0 {
-			s.bot.SendMessage(telegram.BotMessage{Text: message})
+		instant, held := splitForDigest(user.Settings, newAlbums)
+		if quietMode(user.Settings, time.Now()) == db.QuietHold {
+			held, instant = append(held, instant...), nil
 		}
-		s.ShowAlbums(newAlbums, spotifyContext)
-		logger.General.Println("Finished checking for new releases")
-		err = s.db.Save()
-		if err != nil {
-			logger.Error.Println("db save failed:", err)
+		slog.InfoContext(spotifyContext, "found new releases", "releases", len(newAlbums), "filtered", check.Filtered, "held", len(held))
+		if len(held) > 0 {
+			s.holdForDigest(user.UserId, check.Id, held)
+		}
+		if request.Notifications {
+			text := format.New(format.MarkdownV2).Text(fmt.Sprintf("Found %d new releases", len(newAlbums)))
+			if check.Filtered > 0 {
+				text.Text(fmt.Sprintf(", %d filtered out by your settings", check.Filtered))
+			}
+			if len(held) > 0 {
+				text.Text(", they will be sent later in one message")
+			}
+			message := telegram.FormattedMessage(text)
+			message.ChatId = user.ChatId
+			s.bot.SendMessage(message)
 		}
+		s.ShowAlbums(*user, check.Id, instant, spotifyContext)
+		slog.InfoContext(spotifyContext, "finished checking for new releases")
 	}()
+	return &record, nil
 }
 
-func (s *Server) ShowAlbums(albums []spotify.Album, ctx context.Context) {
+// ShowAlbums sends the albums to the user and records them in the
+// notification ledger
+func (s *Server) ShowAlbums(user db.User, checkId string, albums []spotify.Album, ctx context.Context) {
+	results := make([]<-chan telegram.SendResult, 0, len(albums))
+	sent := make([]spotify.Album, 0, len(albums))
+	silent := quietMode(user.Settings, time.Now()) == db.QuietSilent
+Loop:
 	for _, album := range albums {
 		select {
 		case <-ctx.Done():
-			return
+			break Loop
 		default:
-			// TODO: show all artist, or verify that first is main
-			logger.General.Printf("\x1b[34mNew release '%s'\tby %s\tfrom %s\n\x1b[0m", album.Name, album.Artists[0].Name, album.ReleaseDate.Format("02.01.2006"))
-			parseMode := "Markdown"
-			message := telegram.BotMessage{
-				Text:        fmt.Sprintf("*%s* · %s[ㅤ](%s)", escapeCharacters(album.Name), escapeCharacters(album.Artists[0].Name), album.Url),
-				ParseMode:   &parseMode,
-				ReplyMarkup: telegram.ButtonRow(telegram.CallbackButton("Play", "/play "+album.Uri), telegram.CallbackButton("Add to queue", "/queue "+album.Id)),
-			}
-			// TODO: async sending messages
-			err := s.bot.SendMessage(message)
-			if err != nil {
-				logger.Error.Println("error sending message with new release:", err)
+			slog.InfoContext(ctx, "new release", "album_id", album.Id, "album", album.Name, "artist", releaseArtists(album), "release_date", album.ReleaseDate.Format("2006-01-02"))
+			message := albumMessage(album, user.Settings.Style)
+			message.ChatId = user.ChatId
+			if silent || albumLevel(user.Settings, album) == db.LevelSilent {
+				disableNotification := true
+				message.DisableNotification = &disableNotification
 			}
+			results = append(results, s.bot.Send(message))
+			sent = append(sent, album)
 		}
 	}
+
+	// Queued messages are delivered even if the check is canceled
+	for i, result := range results {
+		delivered := <-result
+		notification := db.Notification{
+			UserId:  user.UserId,
+			ChatId:  user.ChatId,
+			CheckId: checkId,
+			Sent:    time.Now(),
+			Album:   sent[i],
+		}
+		if delivered.Err != nil {
+			notification.Error = delivered.Err.Error()
+			slog.ErrorContext(ctx, "error sending message with new release", "error", delivered.Err)
+		} else {
+			notification.MessageId = delivered.Message.MessageId
+		}
+		s.db.AddNotification(notification)
+	}
 }
 
-func escapeCharacters(raw string) string {
-	new := ""
-	for _, ch := range raw {
-		if ch == '_' || ch == '*' || ch == '`' || ch == '[' {
-			new = new + "\\"
+// releaseArtists names followed artists of the release, or the main artist if
+// they are unknown
+func releaseArtists(album spotify.Album) string {
+	artists := album.Followed
+	if len(artists) == 0 && len(album.Artists) > 0 {
+		artists = album.Artists[:1]
+	}
+	names := make([]string, 0, len(artists))
+	for _, artist := range artists {
+		names = append(names, artist.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// appendArtists adds credited artists of the release linked to their pages.
+// Followed artists are bold, followed artists not credited on the release
+// are featured on it
+func appendArtists(text *format.Builder, album spotify.Album) {
+	followed := make(map[string]bool, len(album.Followed))
+	for _, artist := range album.Followed {
+		followed[artist.Id] = true
+	}
+	link := func(artist spotify.Artist) {
+		if followed[artist.Id] {
+			text.BoldLink(artist.Name, artist.Url())
+		} else {
+			text.Link(artist.Name, artist.Url())
+		}
+	}
+
+	credited := make(map[string]bool, len(album.Artists))
+	for i, artist := range album.Artists {
+		if i > 0 {
+			text.Text(", ")
+		}
+		credited[artist.Id] = true
+		link(artist)
+	}
+	featured := 0
+	for _, artist := range album.Followed {
+		if credited[artist.Id] {
+			continue
+		}
+		if featured == 0 {
+			text.Text(" feat. ")
+		} else {
+			text.Text(", ")
 		}
-		new = new + string(ch)
+		featured++
+		link(artist)
 	}
-	return new
 }
 
-func (s *Server) AddToQueue(callback telegram.Callback) {
-	user := s.db.Get()
+// albumMessage renders a release in the notification style. The compact
+// style has no preview and buttons
+func albumMessage(album spotify.Album, style string) telegram.BotMessage {
+	if style == db.StyleCompact {
+		text := format.New(format.MarkdownV2).
+			Link(album.Name, album.Url).
+			Text(" · ")
+		appendArtists(text, album)
+		message := telegram.FormattedMessage(text)
+		disablePreview := true
+		message.DisableWebPagePreview = &disablePreview
+		return message
+	}
+
+	// Invisible link adds the album preview. Telegram previews the first link,
+	// so it goes before links to artists
+	text := format.New(format.MarkdownV2).
+		Link("ㅤ", album.Url).
+		Bold(album.Name).
+		Text(" · ")
+	appendArtists(text, album)
+	message := telegram.FormattedMessage(text)
+	message.ReplyMarkup = telegram.ButtonRow(telegram.CallbackButton("Play", "/play "+album.Uri), telegram.CallbackButton("Add to queue", "/queue "+album.Id))
+	// Each followed artist of a shared release can be muted separately
+	if len(album.Followed) > 1 {
+		var mute []telegram.InlineKeyboardButton
+		for _, artist := range album.Followed {
+			mute = append(mute, telegram.CallbackButton("Mute "+artist.Name, "/mute "+artist.Id))
+		}
+		message.ReplyMarkup.InlineKeyboard = append(message.ReplyMarkup.InlineKeyboard, mute)
+	} else if len(album.Followed) == 1 {
+		mute := []telegram.InlineKeyboardButton{telegram.CallbackButton("Mute artist", "/mute "+album.Followed[0].Id)}
+		message.ReplyMarkup.InlineKeyboard = append(message.ReplyMarkup.InlineKeyboard, mute)
+	} else if len(album.Artists) > 0 {
+		mute := []telegram.InlineKeyboardButton{telegram.CallbackButton("Mute artist", "/mute "+album.Artists[0].Id)}
+		message.ReplyMarkup.InlineKeyboard = append(message.ReplyMarkup.InlineKeyboard, mute)
+	}
+	return message
+}
+
+// SendTestNotification sends a message to the chat of the user, to verify
+// that notifications are delivered
+func (s *Server) SendTestNotification(userId int) (*telegram.Message, error) {
+	user := s.db.Get(userId)
 	if user == nil {
-		logger.Error.Println("No spotify account authorized")
-		return
+		return nil, errNoUser
 	}
-	tracks, err := s.spotifyClient.GetAlbumTracks(&user.Token, callback.Data, 50, 0, nil)
+	message := telegram.FormattedMessage(format.New(format.MarkdownV2).
+		Bold("Test notification").
+		Text(". New releases are sent to this chat"))
+	message.ChatId = user.ChatId
+	sent, err := s.bot.SendMessage(message)
 	if err != nil {
-		logger.Error.Printf("failed getting album tracks: %s\n", err)
+		return nil, fmt.Errorf("error sending test notification: %w", err)
+	}
+	return sent, nil
+}
+
+// playerErrorAnswer turns known Spotify player restrictions into a message for the user
+func playerErrorAnswer(err error) (telegram.CallbackAnswer, error) {
+	switch {
+	case errors.Is(err, spotify.ErrNoActiveDevice):
+		return telegram.CallbackAnswer{Text: "No active device. Start Spotify on any device and try again", ShowAlert: true}, nil
+	case errors.Is(err, spotify.ErrPremiumRequired):
+		return telegram.CallbackAnswer{Text: "Spotify Premium required", ShowAlert: true}, nil
+	}
+	return telegram.CallbackAnswer{}, err
+}
+
+func (s *Server) AddToQueue(callback telegram.Callback) (telegram.CallbackAnswer, error) {
+	user := s.db.Get(callback.UserId)
+	if user == nil {
+		return telegram.CallbackAnswer{}, errNoUser
 	}
+	tracks, err := s.spotifyClient.GetAlbumTracks(&user.Token, callback.Data, 50, 0, nil, context.Background())
+	if err != nil {
+		return telegram.CallbackAnswer{}, fmt.Errorf("failed getting album tracks: %w", err)
+	}
+	queued := 0
 	for _, track := range tracks {
 		err = s.spotifyClient.AddItemtoPlaybackQueue(&user.Token, &track.Uri, nil)
 		if err != nil {
-			logger.Error.Printf("add to queue failed with error: %s\n", err)
-			// TODO: collect errors or skip them. Maybe problem with one track only, but maybe I will get 50 notifications for album
+			slog.Warn("add to queue failed", "user_id", callback.UserId, "track", track.Uri, "error", err)
 			break
 		}
+		queued++
+	}
+	if err != nil {
+		if queued == 0 {
+			return playerErrorAnswer(err)
+		}
+		return partialQueueAnswer(queued, len(tracks), err), nil
+	}
+	return telegram.CallbackAnswer{Text: fmt.Sprintf("Queued %d tracks", queued)}, nil
+}
+
+// partialQueueAnswer tells how many tracks were queued. Known player
+// restrictions are explained, other errors are only logged
+func partialQueueAnswer(queued, total int, err error) telegram.CallbackAnswer {
+	text := fmt.Sprintf("Queued %d of %d tracks, some tracks were not queued", queued, total)
+	if answer, unknown := playerErrorAnswer(err); unknown == nil {
+		text = fmt.Sprintf("Queued %d of %d tracks. %s", queued, total, answer.Text)
 	}
+	return telegram.CallbackAnswer{Text: text, ShowAlert: true}
 }
 
-func (s *Server) PlayTrack(callback telegram.Callback) {
-	user := s.db.Get()
+func (s *Server) PlayTrack(callback telegram.Callback) (telegram.CallbackAnswer, error) {
+	user := s.db.Get(callback.UserId)
 	if user == nil {
-		logger.Error.Println("No spotify account authorized")
-		return
+		return telegram.CallbackAnswer{}, errNoUser
 	}
 	err := s.spotifyClient.StartResumePlayback(&user.Token, &callback.Data, nil)
 	if err != nil {
-		logger.Error.Printf("play track failed with error: %s\n", err)
+		return playerErrorAnswer(fmt.Errorf("play track failed: %w", err))
 	}
+	return telegram.CallbackAnswer{Text: "Playing"}, nil
 }
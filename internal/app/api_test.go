@@ -0,0 +1,81 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/spotify"
+)
+
+func Test_albumMessage_followed(t *testing.T) {
+	album := spotify.Album{
+		Id:       "album",
+		Name:     "Split",
+		Artists:  []spotify.Artist{{Id: "a", Name: "A"}, {Id: "b", Name: "B"}, {Id: "c", Name: "C"}},
+		Followed: []spotify.Artist{{Id: "a", Name: "A"}, {Id: "c", Name: "C"}},
+	}
+	if got := releaseArtists(album); got != "A, C" {
+		t.Errorf("releaseArtists() = %q, want followed artists", got)
+	}
+
+	message := albumMessage(album, db.StyleFull)
+	rows := message.ReplyMarkup.InlineKeyboard
+	mute := rows[len(rows)-1]
+	if len(mute) != 2 || mute[0].CallbackData != "/mute a" || mute[1].Text != "Mute C" {
+		t.Errorf("mute buttons = %+v", mute)
+	}
+
+	// The followed artist of a feature is not the main one
+	album.Followed = album.Followed[1:]
+	rows = albumMessage(album, db.StyleFull).ReplyMarkup.InlineKeyboard
+	mute = rows[len(rows)-1]
+	if len(mute) != 1 || mute[0].CallbackData != "/mute c" {
+		t.Errorf("mute buttons of a feature = %+v", mute)
+	}
+}
+
+func Test_albumMessage_artists(t *testing.T) {
+	album := spotify.Album{
+		Name: "Album",
+		Url:  "https://album",
+		Artists: []spotify.Artist{
+			{Id: "a", Name: "A", ExternalUrls: spotify.ExternalUrls{Spotify: "https://a"}},
+			{Id: "b", Name: "B"},
+		},
+		Followed: []spotify.Artist{{Id: "b", Name: "B"}, {Id: "c", Name: "C", ExternalUrls: spotify.ExternalUrls{Spotify: "https://c"}}},
+	}
+	tests := []struct {
+		style string
+		want  string
+	}{
+		{style: db.StyleFull, want: "[ㅤ](https://album)*Album* · [A](https://a), *[B](https://open.spotify.com/artist/b)* feat\\. *[C](https://c)*"},
+		{style: db.StyleCompact, want: "[Album](https://album) · [A](https://a), *[B](https://open.spotify.com/artist/b)* feat\\. *[C](https://c)*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.style, func(t *testing.T) {
+			if got := albumMessage(album, tt.style).Text; got != tt.want {
+				t.Errorf("albumMessage() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_partialQueueAnswer(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "known", err: fmt.Errorf("add to queue failed: %w", spotify.ErrNoActiveDevice), want: "Queued 3 of 10 tracks. No active device. Start Spotify on any device and try again"},
+		{name: "unknown", err: errors.New("http request fail: 502 Bad Gateway, upstream token=secret"), want: "Queued 3 of 10 tracks, some tracks were not queued"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := partialQueueAnswer(3, 10, tt.err); got.Text != tt.want || !got.ShowAlert {
+				t.Errorf("partialQueueAnswer() = %+v, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/spotify"
+	"TeleBotNotifications/internal/telegram"
+	"TeleBotNotifications/internal/telegram/format"
+)
+
+// Artists on one page of the /artists list
+const artistsPageSize = 8
+
+// Followed artists are fetched again after this time, turning pages of the
+// list doesn't call Spotify every time
+const followedArtistsTTL = 10 * time.Minute
+
+// Choices offered by /mute when the name matches several artists
+const maxMuteChoices = 8
+
+var levelMarks = map[string]string{
+	db.LevelMuted:    "🔇",
+	db.LevelSilent:   "🔕",
+	db.LevelNormal:   "▫️",
+	db.LevelPriority: "⭐",
+}
+
+type followedArtists struct {
+	artists []spotify.Artist
+	fetched time.Time
+}
+
+type artistCache struct {
+	mu    sync.Mutex
+	users map[int]followedArtists
+}
+
+func newArtistCache() *artistCache {
+	return &artistCache{users: make(map[int]followedArtists)}
+}
+
+// followedArtists returns artists followed by the user ordered by name
+func (s *Server) followedArtists(user *db.User) ([]spotify.Artist, error) {
+	s.artists.mu.Lock()
+	cached, ok := s.artists.users[user.UserId]
+	s.artists.mu.Unlock()
+	if ok && time.Since(cached.fetched) < followedArtistsTTL {
+		return cached.artists, nil
+	}
+
+	artists, err := s.spotifyClient.GetFollowedArtists(&user.Token, context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("error getting followed artists: %w", err)
+	}
+	sort.Slice(artists, func(i, j int) bool {
+		return strings.ToLower(artists[i].Name) < strings.ToLower(artists[j].Name)
+	})
+	s.artists.mu.Lock()
+	s.artists.users[user.UserId] = followedArtists{artists: artists, fetched: time.Now()}
+	s.artists.mu.Unlock()
+	return artists, nil
+}
+
+// nextLevel cycles through levels from muted to priority
+func nextLevel(level string) string {
+	for i, l := range db.Levels {
+		if l == level {
+			return db.Levels[(i+1)%len(db.Levels)]
+		}
+	}
+	return db.LevelNormal
+}
+
+// artistsPage renders a page of followed artists with a button changing the
+// level of each one
+func artistsPage(settings db.Settings, artists []spotify.Artist, page int) (*format.Builder, *telegram.InlineKeyboardMarkup) {
+	pages := (len(artists) + artistsPageSize - 1) / artistsPageSize
+	text := format.New(format.MarkdownV2).
+		Bold(fmt.Sprintf("Followed artists: %d", len(artists))).
+		Line("").
+		Text("Press an artist to change the level: muted releases are skipped, silent ones come without sound, priority ones skip the digest")
+	if pages > 1 {
+		text.Line("").Text(fmt.Sprintf("Page %d of %d", page+1, pages))
+	}
+
+	keyboard := &telegram.InlineKeyboardMarkup{}
+	start := page * artistsPageSize
+	end := min(start+artistsPageSize, len(artists))
+	for _, artist := range artists[start:end] {
+		level := settings.ArtistLevel(artist.Id)
+		button := telegram.CallbackButton(
+			fmt.Sprintf("%s %s · %s", levelMarks[level], artist.Name, level),
+			fmt.Sprintf("/level %s %d", artist.Id, page))
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []telegram.InlineKeyboardButton{button})
+	}
+	var navigation []telegram.InlineKeyboardButton
+	if page > 0 {
+		navigation = append(navigation, telegram.CallbackButton("‹ Previous", fmt.Sprintf("/artists %d", page-1)))
+	}
+	if page < pages-1 {
+		navigation = append(navigation, telegram.CallbackButton("Next ›", fmt.Sprintf("/artists %d", page+1)))
+	}
+	if len(navigation) > 0 {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, navigation)
+	}
+	return text, keyboard
+}
+
+// Artists sends the first page of followed artists
+func (s *Server) Artists(message telegram.ReceivedMessage) error {
+	user := s.db.Get(message.UserId)
+	if user == nil {
+		return errNoUser
+	}
+	artists, err := s.followedArtists(user)
+	if err != nil {
+		return err
+	}
+	if len(artists) == 0 {
+		return telegram.NewUserError("You don't follow any artists on Spotify")
+	}
+
+	text, keyboard := artistsPage(user.Settings, artists, 0)
+	reply := telegram.FormattedMessage(text)
+	reply.ChatId = message.ChatId
+	reply.ReplyMarkup = keyboard
+	_, err = s.bot.SendMessage(reply)
+	if err != nil {
+		return fmt.Errorf("error sending artists: %w", err)
+	}
+	return nil
+}
+
+// showArtistsPage replaces the artists message of the callback with the page
+func (s *Server) showArtistsPage(callback telegram.Callback, user *db.User, page int) error {
+	artists, err := s.followedArtists(user)
+	if err != nil {
+		return err
+	}
+	pages := (len(artists) + artistsPageSize - 1) / artistsPageSize
+	if page < 0 || page >= pages {
+		return telegram.NewUserError("The list of artists changed, use /artists again")
+	}
+
+	text, keyboard := artistsPage(user.Settings, artists, page)
+	parseMode := string(text.Mode())
+	_, err = s.bot.EditMessageText(telegram.EditedMessage{
+		ChatId:      callback.ChatId,
+		MessageId:   callback.MessageId,
+		Text:        text.String(),
+		ParseMode:   &parseMode,
+		ReplyMarkup: keyboard,
+	})
+	if err != nil {
+		return fmt.Errorf("error showing artists page: %w", err)
+	}
+	return nil
+}
+
+// ArtistsPage turns a page of the /artists list
+func (s *Server) ArtistsPage(callback telegram.Callback) (telegram.CallbackAnswer, error) {
+	user := s.db.Get(callback.UserId)
+	if user == nil {
+		return telegram.CallbackAnswer{}, errNoUser
+	}
+	page, err := strconv.Atoi(callback.Data)
+	if err != nil {
+		return telegram.CallbackAnswer{}, telegram.NewUserError("Wrong page %q", callback.Data)
+	}
+	return telegram.CallbackAnswer{}, s.showArtistsPage(callback, user, page)
+}
+
+// artistName finds the name of the artist in the settings, sent releases and
+// followed artists of the user
+func (s *Server) artistName(user *db.User, artistId string) string {
+	if artist, ok := user.Settings.Artists[artistId]; ok && artist.Name != "" {
+		return artist.Name
+	}
+	for _, notification := range s.db.Notifications(user.UserId, 0) {
+		for _, artist := range notification.Album.Artists {
+			if artist.Id == artistId {
+				return artist.Name
+			}
+		}
+	}
+	artists, err := s.followedArtists(user)
+	if err != nil {
+		slog.Warn("artist name unknown", "user_id", user.UserId, "artist_id", artistId, "error", err)
+	}
+	for _, artist := range artists {
+		if artist.Id == artistId {
+			return artist.Name
+		}
+	}
+	return artistId
+}
+
+func (s *Server) setArtistLevel(user *db.User, artistId, name, level string) {
+	s.updateSettings(user.UserId, func(settings *db.Settings) {
+		settings.SetArtistLevel(artistId, name, level)
+	})
+	user.Settings.SetArtistLevel(artistId, name, level)
+	slog.Info("artist level changed", "user_id", user.UserId, "artist_id", artistId, "level", level)
+}
+
+// CycleArtistLevel changes the level of an artist from the /artists list
+func (s *Server) CycleArtistLevel(callback telegram.Callback) (telegram.CallbackAnswer, error) {
+	user := s.db.Get(callback.UserId)
+	if user == nil {
+		return telegram.CallbackAnswer{}, errNoUser
+	}
+	artistId, pageText, _ := strings.Cut(callback.Data, " ")
+	page, err := strconv.Atoi(pageText)
+	if artistId == "" || err != nil {
+		return telegram.CallbackAnswer{}, telegram.NewUserError("Wrong artist %q", callback.Data)
+	}
+
+	name := s.artistName(user, artistId)
+	level := nextLevel(user.Settings.ArtistLevel(artistId))
+	s.setArtistLevel(user, artistId, name, level)
+	if err := s.showArtistsPage(callback, user, page); err != nil {
+		return telegram.CallbackAnswer{}, err
+	}
+	return telegram.CallbackAnswer{Text: fmt.Sprintf("%s: %s", name, level)}, nil
+}
+
+// ToggleMute mutes the artist of a release message or unmutes a muted one
+func (s *Server) ToggleMute(callback telegram.Callback) (telegram.CallbackAnswer, error) {
+	user := s.db.Get(callback.UserId)
+	if user == nil {
+		return telegram.CallbackAnswer{}, errNoUser
+	}
+	if callback.Data == "" {
+		return telegram.CallbackAnswer{}, telegram.NewUserError("Unknown artist")
+	}
+
+	name := s.artistName(user, callback.Data)
+	if user.Settings.ArtistLevel(callback.Data) == db.LevelMuted {
+		s.setArtistLevel(user, callback.Data, name, db.LevelNormal)
+		return telegram.CallbackAnswer{Text: fmt.Sprintf("%s is unmuted", name)}, nil
+	}
+	s.setArtistLevel(user, callback.Data, name, db.LevelMuted)
+	return telegram.CallbackAnswer{Text: fmt.Sprintf("%s is muted. Press again or use /artists to unmute", name)}, nil
+}
+
+// matchArtists returns artists with the name, or artists with the text in the
+// name if none is named exactly so
+func matchArtists(artists []spotify.Artist, name string) []spotify.Artist {
+	name = strings.ToLower(strings.TrimSpace(name))
+	var exact, partial []spotify.Artist
+	for _, artist := range artists {
+		artistName := strings.ToLower(artist.Name)
+		switch {
+		case artistName == name:
+			exact = append(exact, artist)
+		case strings.Contains(artistName, name):
+			partial = append(partial, artist)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return partial
+}
+
+// Mute mutes a followed artist by name. Several matching artists are offered
+// as buttons
+func (s *Server) Mute(message telegram.ReceivedMessage) error {
+	user := s.db.Get(message.UserId)
+	if user == nil {
+		return errNoUser
+	}
+	if message.Text == "" {
+		return telegram.NewUserError("Use /mute <artist name>, or /artists to see all followed artists")
+	}
+	artists, err := s.followedArtists(user)
+	if err != nil {
+		return err
+	}
+
+	matches := matchArtists(artists, message.Text)
+	text := format.New(format.MarkdownV2)
+	var keyboard *telegram.InlineKeyboardMarkup
+	switch {
+	case len(matches) == 0:
+		return telegram.NewUserError("No followed artist is named %q", message.Text)
+	case len(matches) == 1:
+		s.setArtistLevel(user, matches[0].Id, matches[0].Name, db.LevelMuted)
+		text.Bold(matches[0].Name).Text(" is muted. Use ").Code("/artists").Text(" to unmute")
+	default:
+		text.Text(fmt.Sprintf("%d artists match, choose one to mute", len(matches)))
+		keyboard = &telegram.InlineKeyboardMarkup{}
+		for _, artist := range matches[:min(len(matches), maxMuteChoices)] {
+			keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []telegram.InlineKeyboardButton{
+				telegram.CallbackButton(artist.Name, "/mute "+artist.Id),
+			})
+		}
+	}
+
+	reply := telegram.FormattedMessage(text)
+	reply.ChatId = message.ChatId
+	reply.ReplyMarkup = keyboard
+	_, err = s.bot.SendMessage(reply)
+	if err != nil {
+		return fmt.Errorf("error sending mute result: %w", err)
+	}
+	return nil
+}
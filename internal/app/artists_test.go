@@ -0,0 +1,94 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/spotify"
+	"TeleBotNotifications/internal/telegram"
+)
+
+func Test_nextLevel(t *testing.T) {
+	level := db.LevelNormal
+	var seen []string
+	for range db.Levels {
+		level = nextLevel(level)
+		seen = append(seen, level)
+	}
+	want := []string{db.LevelPriority, db.LevelMuted, db.LevelSilent, db.LevelNormal}
+	if fmt.Sprint(seen) != fmt.Sprint(want) {
+		t.Errorf("levels = %v, want %v", seen, want)
+	}
+}
+
+func Test_matchArtists(t *testing.T) {
+	artists := []spotify.Artist{{Id: "1", Name: "Muse"}, {Id: "2", Name: "Museum"}, {Id: "3", Name: "The Muses"}}
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "exact wins", text: "muse", want: []string{"1"}},
+		{name: "partial", text: "muses", want: []string{"3"}},
+		{name: "several", text: "mus", want: []string{"1", "2", "3"}},
+		{name: "none", text: "queen"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, artist := range matchArtists(artists, tt.text) {
+				got = append(got, artist.Id)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("matchArtists(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_artistsPage(t *testing.T) {
+	var artists []spotify.Artist
+	for i := 0; i < artistsPageSize+2; i++ {
+		artists = append(artists, spotify.Artist{Id: fmt.Sprintf("id%d", i), Name: fmt.Sprintf("Artist %d", i)})
+	}
+	settings := db.Settings{}
+	settings.SetArtistLevel("id9", "Artist 9", db.LevelMuted)
+
+	_, keyboard := artistsPage(settings, artists, 1)
+	rows := keyboard.InlineKeyboard
+	if len(rows) != 3 {
+		t.Fatalf("keyboard has %d rows, want 2 artists and navigation", len(rows))
+	}
+	if rows[1][0].CallbackData != "/level id9 1" || rows[1][0].Text != "🔇 Artist 9 · muted" {
+		t.Errorf("artist button = %+v", rows[1][0])
+	}
+	if len(rows[2]) != 1 || rows[2][0].CallbackData != "/artists 0" {
+		t.Errorf("navigation = %+v", rows[2])
+	}
+}
+
+func Test_ToggleMute(t *testing.T) {
+	s := newTestServer(t)
+	s.db.AddNotification(db.Notification{UserId: 1, Sent: time.Now(), Album: spotify.Album{
+		Artists: []spotify.Artist{{Id: "artist", Name: "Artist"}},
+	}})
+	callback := telegram.Callback{UserId: 1, Data: "artist"}
+
+	answer, err := s.ToggleMute(callback)
+	if err != nil {
+		t.Fatalf("ToggleMute() error = %v", err)
+	}
+	settings := s.db.Get(1).Settings
+	if settings.ArtistLevel("artist") != db.LevelMuted || settings.Artists["artist"].Name != "Artist" {
+		t.Errorf("settings after mute = %+v, answer %q", settings.Artists, answer.Text)
+	}
+
+	if _, err := s.ToggleMute(callback); err != nil {
+		t.Fatalf("ToggleMute() error = %v", err)
+	}
+	if level := s.db.Get(1).Settings.ArtistLevel("artist"); level != db.LevelNormal {
+		t.Errorf("level after the second press = %s", level)
+	}
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/spotify"
+)
+
+// https://www.rfc-editor.org/rfc/rfc5545
+const icsDateFormat = "20060102"
+const icsTimeFormat = "20060102T150405Z"
+
+// Lines longer than this are folded
+const icsLineLength = 75
+
+var icsTextReplacer = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func icsEscape(text string) string {
+	return icsTextReplacer.Replace(text)
+}
+
+// icsFold splits a content line into lines of at most icsLineLength octets
+// without breaking UTF-8 sequences
+func icsFold(line string) string {
+	var b strings.Builder
+	limit := icsLineLength
+	for len(line) > limit {
+		cut := limit
+		// Continuation bytes have the 10xxxxxx form
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space counts into the length
+		limit = icsLineLength - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+type icsWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (c *icsWriter) line(name, value string) {
+	if c.err != nil {
+		return
+	}
+	_, c.err = io.WriteString(c.w, icsFold(name+":"+value))
+}
+
+// releaseDescription lists artists, album type and the link of the release
+func releaseDescription(album spotify.Album) string {
+	return fmt.Sprintf("Artists: %s\nType: %s\nReleased: %s\n%s",
+		artistNames(album.Artists), album.AlbumType, album.FormatReleaseDate(), album.Url)
+}
+
+// writeCalendar writes releases as all day events. Releases known to a month
+// or a year span the whole period
+func writeCalendar(w io.Writer, releases []db.Notification) error {
+	c := &icsWriter{w: w}
+	c.line("BEGIN", "VCALENDAR")
+	c.line("VERSION", "2.0")
+	c.line("PRODID", "-//TeleBotNotifications//Spotify releases//EN")
+	c.line("CALSCALE", "GREGORIAN")
+	c.line("X-WR-CALNAME", "New releases")
+
+	for _, release := range releases {
+		album := release.Album
+		start, end := album.ReleasePeriod()
+		c.line("BEGIN", "VEVENT")
+		c.line("UID", album.Id+"@spotify-releases")
+		c.line("DTSTAMP", release.Sent.UTC().Format(icsTimeFormat))
+		c.line("DTSTART;VALUE=DATE", start.Format(icsDateFormat))
+		c.line("DTEND;VALUE=DATE", end.Format(icsDateFormat))
+		c.line("SUMMARY", icsEscape(releaseTitle(album)))
+		c.line("DESCRIPTION", icsEscape(releaseDescription(album)))
+		c.line("CATEGORIES", icsEscape(album.AlbumType))
+		c.line("URL", album.Url)
+		// Releases don't make the day busy
+		c.line("TRANSP", "TRANSPARENT")
+		c.line("END", "VEVENT")
+	}
+
+	c.line("END", "VCALENDAR")
+	return c.err
+}
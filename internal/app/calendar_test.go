@@ -0,0 +1,98 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/spotify"
+)
+
+func Test_icsFold(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "short", line: "SUMMARY:short"},
+		{name: "ascii", line: "DESCRIPTION:" + strings.Repeat("a", 200)},
+		{name: "utf8", line: "SUMMARY:" + strings.Repeat("ё", 100)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			folded := icsFold(tt.line)
+			if !strings.HasSuffix(folded, "\r\n") {
+				t.Errorf("icsFold() doesn't end with CRLF")
+			}
+			lines := strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n")
+			for i, line := range lines {
+				if len(line) > icsLineLength {
+					t.Errorf("line %d is %d octets long", i, len(line))
+				}
+				if i > 0 && !strings.HasPrefix(line, " ") {
+					t.Errorf("continuation line %d doesn't start with a space", i)
+				}
+			}
+			unfolded := strings.ReplaceAll(strings.TrimSuffix(folded, "\r\n"), "\r\n ", "")
+			if unfolded != tt.line {
+				t.Errorf("unfolded line = %q, want %q", unfolded, tt.line)
+			}
+		})
+	}
+}
+
+func Test_writeCalendar(t *testing.T) {
+	release := func(id, precision string, date time.Time) db.Notification {
+		return db.Notification{Album: spotify.Album{
+			Id:                   id,
+			Name:                 "Name, with; chars",
+			AlbumType:            "album",
+			Url:                  "https://open.spotify.com/album/" + id,
+			ReleaseDate:          date,
+			ReleaseDatePrecision: precision,
+			Artists:              []spotify.Artist{{Name: "Artist"}},
+		}}
+	}
+	releases := []db.Notification{
+		release("day", "day", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)),
+		release("month", "month", time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)),
+		release("year", "year", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+
+	var b strings.Builder
+	if err := writeCalendar(&b, releases); err != nil {
+		t.Fatalf("writeCalendar() error = %v", err)
+	}
+	calendar := strings.ReplaceAll(b.String(), "\r\n ", "")
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"DTSTART;VALUE=DATE:20240229\r\nDTEND;VALUE=DATE:20240301\r\n",
+		"DTSTART;VALUE=DATE:20241201\r\nDTEND;VALUE=DATE:20250101\r\n",
+		"DTSTART;VALUE=DATE:20230101\r\nDTEND;VALUE=DATE:20240101\r\n",
+		`SUMMARY:Artist – Name\, with\; chars`,
+		`DESCRIPTION:Artists: Artist\nType: album\nReleased: December 2024\nhttps://open.spotify.com/album/month`,
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(calendar, want) {
+			t.Errorf("calendar doesn't contain %q:\n%s", want, calendar)
+		}
+	}
+	if strings.Count(calendar, "BEGIN:VEVENT") != 3 {
+		t.Errorf("calendar has %d events, want 3", strings.Count(calendar, "BEGIN:VEVENT"))
+	}
+}
+
+func Test_calendarFeed(t *testing.T) {
+	_, mux := newFeedServer(t)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/feeds/feedtoken/releases.ics", nil))
+
+	if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("status = %d, content type = %s", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	if strings.Count(recorder.Body.String(), "BEGIN:VEVENT") != 1 {
+		t.Errorf("calendar = %s, want one event", recorder.Body)
+	}
+}
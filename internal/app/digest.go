@@ -0,0 +1,339 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/scheduler"
+	"TeleBotNotifications/internal/spotify"
+	"TeleBotNotifications/internal/telegram"
+	"TeleBotNotifications/internal/telegram/format"
+)
+
+// Releases on one page of a digest message
+const digestPageSize = 10
+
+// Digest schedules the /digest command accepts by name
+var digestPresets = map[string]string{
+	"daily":  "0 9 * * *",
+	"weekly": "0 18 * * 5",
+}
+
+// Album types in the order of digest sections
+var digestSections = []struct {
+	albumType string
+	title     string
+}{
+	{"album", "Albums"},
+	{"single", "Singles"},
+	{"compilation", "Compilations"},
+}
+
+func digestJob(userId int) string {
+	return "digest:" + strconv.Itoa(userId)
+}
+
+// splitForDigest returns releases sent instantly and releases held for the
+// digest. Only releases of priority artists are instant in the digest mode
+func splitForDigest(settings db.Settings, albums []spotify.Album) (instant, held []spotify.Album) {
+	if settings.Digest == "" {
+		return albums, nil
+	}
+	for _, album := range albums {
+		if albumLevel(settings, album) == db.LevelPriority {
+			instant = append(instant, album)
+		} else {
+			held = append(held, album)
+		}
+	}
+	return instant, held
+}
+
+// holdForDigest adds releases found by the check to the next digest of the user
+func (s *Server) holdForDigest(userId int, checkId string, albums []spotify.Album) {
+	found := time.Now()
+	s.db.Update(userId, func(user *db.User) {
+		for _, album := range albums {
+			user.PendingDigest = append(user.PendingDigest, db.DigestRelease{CheckId: checkId, Found: found, Album: album})
+		}
+	})
+}
+
+// scheduleDigest plans digests of the user, or removes them if the user gets
+// releases instantly
+func (s *Server) scheduleDigest(userId int, user *db.User) {
+	key := digestJob(userId)
+	if user == nil || user.Settings.Digest == "" {
+		s.scheduler.Remove(key)
+		return
+	}
+	schedule, err := scheduler.Parse(user.Settings.Digest)
+	if err != nil {
+		slog.Warn("wrong digest schedule", "user_id", userId, "error", err)
+		s.scheduler.Remove(key)
+		return
+	}
+	s.scheduler.Set(key, schedule, user.Settings.Location(), user.LastDigest, func(time.Time) {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := s.SendDigest(userId); err != nil {
+				slog.Error("digest not sent", "user_id", userId, "error", err)
+			}
+		}()
+	})
+}
+
+func sectionIndex(albumType string) int {
+	for i, section := range digestSections {
+		if section.albumType == albumType {
+			return i
+		}
+	}
+	return len(digestSections)
+}
+
+func sectionTitle(albumType string) string {
+	if i := sectionIndex(albumType); i < len(digestSections) {
+		return digestSections[i].title
+	}
+	if albumType == "" {
+		return "Other"
+	}
+	return strings.ToUpper(albumType[:1]) + albumType[1:]
+}
+
+// sortDigest orders releases by album type, then by artist and release date
+func sortDigest(albums []spotify.Album) {
+	sort.SliceStable(albums, func(i, j int) bool {
+		a, b := albums[i], albums[j]
+		if sa, sb := sectionIndex(a.AlbumType), sectionIndex(b.AlbumType); sa != sb {
+			return sa < sb
+		}
+		if a.AlbumType != b.AlbumType {
+			return a.AlbumType < b.AlbumType
+		}
+		if aa, ab := strings.ToLower(releaseArtists(a)), strings.ToLower(releaseArtists(b)); aa != ab {
+			return aa < ab
+		}
+		return a.ReleaseDate.Before(b.ReleaseDate)
+	})
+}
+
+func digestPages(digest *db.Digest) int {
+	return (len(digest.Albums) + digestPageSize - 1) / digestPageSize
+}
+
+// digestPage renders a page of the digest. Section and artist headers are
+// repeated at the top of every page
+func digestPage(digest *db.Digest, page int) telegram.BotMessage {
+	pages := digestPages(digest)
+	text := format.New(format.MarkdownV2).
+		Bold(fmt.Sprintf("New releases: %d", len(digest.Albums))).
+		Line("")
+
+	start := page * digestPageSize
+	end := min(start+digestPageSize, len(digest.Albums))
+	var section, artist string
+	for i, album := range digest.Albums[start:end] {
+		if i == 0 || album.AlbumType != section {
+			section, artist = album.AlbumType, ""
+			text.Line("").Bold(sectionTitle(section)).Line("")
+		}
+		if name := releaseArtists(album); name != artist {
+			artist = name
+			text.Italic(artist).Line("")
+		}
+		text.Text("• ").Link(album.Name, album.Url).Line(" · " + album.FormatReleaseDate())
+	}
+	if pages > 1 {
+		text.Line("").Text(fmt.Sprintf("Page %d of %d", page+1, pages))
+	}
+
+	message := telegram.FormattedMessage(text)
+	disablePreview := true
+	message.DisableWebPagePreview = &disablePreview
+	var buttons []telegram.InlineKeyboardButton
+	if page > 0 {
+		buttons = append(buttons, telegram.CallbackButton("‹ Previous", fmt.Sprintf("/digest %s %d", digest.Id, page-1)))
+	}
+	if page < pages-1 {
+		buttons = append(buttons, telegram.CallbackButton("Next ›", fmt.Sprintf("/digest %s %d", digest.Id, page+1)))
+	}
+	if len(buttons) > 0 {
+		message.ReplyMarkup = telegram.ButtonRow(buttons...)
+	}
+	return message
+}
+
+// SendDigest sends releases held for the digest of the user as one message.
+// Releases stay held if the message is not delivered or if quiet hours hold
+// notifications
+func (s *Server) SendDigest(userId int) error {
+	user := s.db.Get(userId)
+	if user == nil {
+		return errNoUser
+	}
+	quiet := quietMode(user.Settings, time.Now())
+	if quiet == db.QuietHold {
+		// LastDigest stays, so the digest is sent at the end of quiet hours
+		slog.Debug("digest held until the end of quiet hours", "user_id", userId)
+		return nil
+	}
+
+	var held []db.DigestRelease
+	known := s.db.Update(userId, func(user *db.User) {
+		held = user.PendingDigest
+		user.PendingDigest = nil
+		user.LastDigest = time.Now()
+	})
+	if !known {
+		return errNoUser
+	}
+	if len(held) == 0 {
+		slog.Debug("empty digest skipped", "user_id", userId)
+		return nil
+	}
+
+	digest := db.Digest{
+		Id:     strconv.FormatInt(time.Now().UnixNano(), 36),
+		UserId: userId,
+		ChatId: user.ChatId,
+		Sent:   time.Now(),
+	}
+	for _, release := range held {
+		digest.Albums = append(digest.Albums, release.Album)
+	}
+	// Checks of overlapping periods hold the same releases
+	digest.Albums = spotify.DedupeAlbums(digest.Albums)
+	sortDigest(digest.Albums)
+
+	message := digestPage(&digest, 0)
+	message.ChatId = user.ChatId
+	if quiet == db.QuietSilent {
+		silent := true
+		message.DisableNotification = &silent
+	}
+	sent, err := s.bot.SendMessage(message)
+	if err != nil {
+		s.db.Update(userId, func(user *db.User) {
+			user.PendingDigest = append(held, user.PendingDigest...)
+		})
+		return fmt.Errorf("error sending digest: %w", err)
+	}
+	digest.MessageId = sent.MessageId
+	s.db.AddDigest(digest)
+	for _, release := range held {
+		s.db.AddNotification(db.Notification{
+			UserId:    userId,
+			ChatId:    user.ChatId,
+			CheckId:   release.CheckId,
+			MessageId: sent.MessageId,
+			Sent:      digest.Sent,
+			Album:     release.Album,
+		})
+	}
+	if err := s.db.Save(); err != nil {
+		slog.Error("db save failed", "error", err)
+	}
+	slog.Info("digest sent", "user_id", userId, "digest_id", digest.Id, "releases", len(digest.Albums))
+	return nil
+}
+
+// TurnDigestPage shows another page of a sent digest
+func (s *Server) TurnDigestPage(callback telegram.Callback) (telegram.CallbackAnswer, error) {
+	id, pageText, _ := strings.Cut(callback.Data, " ")
+	page, err := strconv.Atoi(pageText)
+	digest := s.db.Digest(id)
+	if digest == nil || digest.UserId != callback.UserId {
+		return telegram.CallbackAnswer{}, telegram.NewUserError("The digest is too old, see the dashboard for past releases")
+	}
+	if err != nil || page < 0 || page >= digestPages(digest) {
+		return telegram.CallbackAnswer{}, telegram.NewUserError("Wrong digest page %q", pageText)
+	}
+
+	message := digestPage(digest, page)
+	_, err = s.bot.EditMessageText(telegram.EditedMessage{
+		ChatId:                callback.ChatId,
+		MessageId:             callback.MessageId,
+		Text:                  message.Text,
+		ParseMode:             message.ParseMode,
+		DisableWebPagePreview: message.DisableWebPagePreview,
+		ReplyMarkup:           message.ReplyMarkup,
+	})
+	if err != nil {
+		return telegram.CallbackAnswer{}, fmt.Errorf("error turning digest page: %w", err)
+	}
+	return telegram.CallbackAnswer{}, nil
+}
+
+// parseDigest turns a digest preset or schedule into the stored setting.
+// Empty text and "off" mean instant notifications
+func parseDigest(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || text == "off" {
+		return "", nil
+	}
+	if preset, ok := digestPresets[text]; ok {
+		return preset, nil
+	}
+	if _, err := scheduler.Parse(text); err != nil {
+		return "", err
+	}
+	return text, nil
+}
+
+// SetDigest shows or changes the digest mode of the user
+func (s *Server) SetDigest(message telegram.ReceivedMessage) error {
+	user := s.db.Get(message.UserId)
+	if user == nil {
+		return errNoUser
+	}
+
+	text := format.New(format.MarkdownV2)
+	if message.Text == "" {
+		if user.Settings.Digest == "" {
+			text.Text("Releases are sent instantly. Use ").Code("/digest daily").Text(", ").
+				Code("/digest weekly").Text(" or ").Code("/digest <cron>").Text(" to get them in one message")
+		} else {
+			text.Text("Digest schedule: ").Code(user.Settings.Digest).
+				Text(fmt.Sprintf(". %d releases are waiting", len(user.PendingDigest)))
+			if next, ok := s.scheduler.Next(digestJob(user.UserId)); ok {
+				text.Text(", next digest at ").Bold(next.Format("2006-01-02 15:04"))
+			}
+			text.Text(". Releases of priority artists are sent instantly. Use ").Code("/digest off").Text(" to get every release instantly")
+		}
+	} else {
+		digest, err := parseDigest(message.Text)
+		if err != nil {
+			return telegram.NewUserError("Wrong digest schedule: %s", err)
+		}
+		s.updateSettings(user.UserId, func(settings *db.Settings) {
+			settings.Digest = digest
+		})
+		s.scheduleUser(user.UserId)
+		if digest == "" {
+			text.Text("Releases are sent instantly")
+			// Nothing is left waiting for a digest that will never come
+			if err := s.SendDigest(user.UserId); err != nil {
+				return err
+			}
+		} else {
+			text.Text("Digest schedule set to ").Code(digest)
+		}
+		slog.Info("digest changed", "user_id", user.UserId, "digest", digest)
+	}
+
+	reply := telegram.FormattedMessage(text)
+	reply.ChatId = message.ChatId
+	_, err := s.bot.SendMessage(reply)
+	if err != nil {
+		return fmt.Errorf("error sending digest settings: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/spotify"
+)
+
+func Test_splitForDigest(t *testing.T) {
+	albums := []spotify.Album{
+		{Id: "a", Artists: []spotify.Artist{{Id: "normal"}}},
+		{Id: "b", Artists: []spotify.Artist{{Id: "normal"}, {Id: "priority"}}},
+	}
+	settings := db.Settings{}
+	settings.SetArtistLevel("priority", "Priority", db.LevelPriority)
+
+	instant, held := splitForDigest(settings, albums)
+	if len(instant) != 2 || len(held) != 0 {
+		t.Errorf("instant mode: instant = %d, held = %d", len(instant), len(held))
+	}
+
+	settings.Digest = digestPresets["daily"]
+	instant, held = splitForDigest(settings, albums)
+	if len(instant) != 1 || instant[0].Id != "b" || len(held) != 1 || held[0].Id != "a" {
+		t.Errorf("digest mode: instant = %+v, held = %+v", instant, held)
+	}
+}
+
+func Test_parseDigest(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{name: "off", text: "off", want: ""},
+		{name: "empty", text: " ", want: ""},
+		{name: "preset", text: "weekly", want: "0 18 * * 5"},
+		{name: "cron", text: "0 20 * * 0", want: "0 20 * * 0"},
+		{name: "wrong", text: "sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDigest(tt.text)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseDigest(%q) = %q, %v, want %q", tt.text, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_digestPage(t *testing.T) {
+	release := func(name, albumType, artist string) spotify.Album {
+		return spotify.Album{
+			Name:        name,
+			AlbumType:   albumType,
+			Url:         "https://open.spotify.com/album/" + name,
+			ReleaseDate: time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC),
+			Artists:     []spotify.Artist{{Name: artist}},
+		}
+	}
+	digest := &db.Digest{Id: "d1", Albums: []spotify.Album{
+		release("S1", "single", "Beta"),
+		release("A1", "album", "Beta"),
+		release("A2", "album", "Alpha"),
+	}}
+	for i := 0; i < digestPageSize; i++ {
+		digest.Albums = append(digest.Albums, release(fmt.Sprintf("C%d", i), "compilation", "Gamma"))
+	}
+	sortDigest(digest.Albums)
+
+	first := digestPage(digest, 0)
+	text := first.Text
+	order := []string{"Albums", "Alpha", "A2", "Beta", "A1", "Singles", "Beta", "S1", "Compilations", "Gamma"}
+	for _, want := range order {
+		i := strings.Index(text, want)
+		if i < 0 {
+			t.Fatalf("first page doesn't contain %q in order:\n%s", want, first.Text)
+		}
+		text = text[i+len(want):]
+	}
+	if first.ReplyMarkup == nil || len(first.ReplyMarkup.InlineKeyboard[0]) != 1 ||
+		first.ReplyMarkup.InlineKeyboard[0][0].CallbackData != "/digest d1 1" {
+		t.Errorf("first page keyboard = %+v", first.ReplyMarkup)
+	}
+
+	last := digestPage(digest, 1)
+	// Headers are repeated on the next page
+	if !strings.Contains(last.Text, "Compilations") || !strings.Contains(last.Text, "Page 2 of 2") {
+		t.Errorf("last page:\n%s", last.Text)
+	}
+	if last.ReplyMarkup == nil || last.ReplyMarkup.InlineKeyboard[0][0].CallbackData != "/digest d1 0" {
+		t.Errorf("last page keyboard = %+v", last.ReplyMarkup)
+	}
+}
@@ -0,0 +1,281 @@
+package app
+
+import (
+	"crypto/subtle"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/spotify"
+)
+
+// Number of releases in a feed
+const feedReleases = 100
+
+// feedUser returns the user owning the feed token or nil
+func (s *Server) feedUser(token string) *db.User {
+	if token == "" {
+		return nil
+	}
+	for _, user := range s.db.Users() {
+		if subtle.ConstantTimeCompare([]byte(user.FeedToken), []byte(token)) == 1 {
+			return &user
+		}
+	}
+	return nil
+}
+
+// feedReleases returns releases delivered to the user, the latest first, like
+// the dashboard. Releases found by several checks are listed once
+func (s *Server) feedReleases(userId int) []db.Notification {
+	seen := make(map[string]bool)
+	releases := []db.Notification{}
+	for _, notification := range s.db.Notifications(userId, 0) {
+		if notification.Error != "" || seen[notification.Album.Id] {
+			continue
+		}
+		seen[notification.Album.Id] = true
+		releases = append(releases, notification)
+		if len(releases) == feedReleases {
+			break
+		}
+	}
+	return releases
+}
+
+// handleFeeds serves /feeds/{token}/atom.xml, /feeds/{token}/rss.xml and
+// /feeds/{token}/releases.ics
+func (s *Server) handleFeeds(w http.ResponseWriter, r *http.Request) {
+	token, name, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/feeds/"), "/")
+	user := s.feedUser(token)
+	if !ok || user == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if name == "releases.ics" {
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		if err := writeCalendar(w, s.feedReleases(user.UserId)); err != nil {
+			slog.Error("calendar writing failed", "user_id", user.UserId, "error", err)
+		}
+		return
+	}
+
+	var feed interface{}
+	var contentType string
+	switch name {
+	case "atom.xml":
+		feed = s.atomFeed(user, s.feedReleases(user.UserId))
+		contentType = "application/atom+xml; charset=utf-8"
+	case "rss.xml":
+		feed = s.rssFeed(user, s.feedReleases(user.UserId))
+		contentType = "application/rss+xml; charset=utf-8"
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(feed); err != nil {
+		slog.Error("feed encoding failed", "user_id", user.UserId, "feed", name, "error", err)
+	}
+}
+
+func artistNames(artists []spotify.Artist) string {
+	names := make([]string, 0, len(artists))
+	for _, artist := range artists {
+		names = append(names, artist.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// releaseTitle is the entry title, e.g. "Artist – Album"
+func releaseTitle(album spotify.Album) string {
+	return artistNames(album.Artists) + " – " + album.Name
+}
+
+// releaseHTML describes the release for feed readers
+func releaseHTML(album spotify.Album) string {
+	var b strings.Builder
+	if album.ImageUrl != "" {
+		fmt.Fprintf(&b, `<p><img src="%s" alt="" width="300"></p>`, html.EscapeString(album.ImageUrl))
+	}
+	fmt.Fprintf(&b, "<p>Artists: %s</p>", html.EscapeString(artistNames(album.Artists)))
+	fmt.Fprintf(&b, "<p>Type: %s</p>", html.EscapeString(album.AlbumType))
+	fmt.Fprintf(&b, "<p>Released: %s</p>", album.FormatReleaseDate())
+	fmt.Fprintf(&b, `<p><a href="%s">Open in Spotify</a></p>`, html.EscapeString(album.Url))
+	return b.String()
+}
+
+// https://www.rfc-editor.org/rfc/rfc4287
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length string `xml:"length,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Id         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Authors    []atomPerson   `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Links      []atomLink     `xml:"link"`
+	Content    atomText       `xml:"content"`
+}
+
+func feedId(user *db.User) string {
+	return "urn:spotify-releases:user:" + strconv.Itoa(user.UserId)
+}
+
+func (s *Server) atomFeed(user *db.User, releases []db.Notification) atomFeed {
+	feed := atomFeed{
+		Id:      feedId(user),
+		Title:   "New releases",
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Links:   []atomLink{{Href: s.webURL("/feeds/" + user.FeedToken + "/atom.xml"), Rel: "self"}},
+	}
+	if len(releases) > 0 {
+		feed.Updated = releases[0].Sent.UTC().Format(time.RFC3339)
+	}
+
+	for _, release := range releases {
+		album := release.Album
+		entry := atomEntry{
+			Id:         album.Uri,
+			Title:      releaseTitle(album),
+			Updated:    release.Sent.UTC().Format(time.RFC3339),
+			Published:  release.Sent.UTC().Format(time.RFC3339),
+			Categories: []atomCategory{{Term: album.AlbumType}},
+			Links:      []atomLink{{Href: album.Url, Rel: "alternate", Type: "text/html"}},
+			Content:    atomText{Type: "html", Body: releaseHTML(album)},
+		}
+		for _, artist := range album.Artists {
+			entry.Authors = append(entry.Authors, atomPerson{Name: artist.Name})
+		}
+		if album.ImageUrl != "" {
+			entry.Links = append(entry.Links, atomLink{Href: album.ImageUrl, Rel: "enclosure", Type: "image/jpeg"})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+// https://www.rssboard.org/rss-specification
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	Url    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int    `xml:"length,attr"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Guid        rssGuid       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Category    string        `xml:"category,omitempty"`
+	Description string        `xml:"description"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+}
+
+func (s *Server) rssFeed(user *db.User, releases []db.Notification) rssFeed {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         "New releases",
+			Link:          s.webURL("/feeds/" + user.FeedToken + "/rss.xml"),
+			Description:   "New releases of followed Spotify artists",
+			LastBuildDate: time.Now().UTC().Format(time.RFC1123Z),
+		},
+	}
+
+	for _, release := range releases {
+		album := release.Album
+		item := rssItem{
+			Title:       releaseTitle(album),
+			Link:        album.Url,
+			Guid:        rssGuid{Value: album.Uri},
+			PubDate:     release.Sent.UTC().Format(time.RFC1123Z),
+			Category:    album.AlbumType,
+			Description: releaseHTML(album),
+		}
+		if album.ImageUrl != "" {
+			// Size of covers is unknown, zero is what readers expect then
+			item.Enclosure = &rssEnclosure{Url: album.ImageUrl, Type: "image/jpeg"}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	return feed
+}
+
+func (s *Server) webRegenerateFeed(w http.ResponseWriter, r *http.Request, user *db.User, _ webSession) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, err := randomToken()
+	if err != nil {
+		http.Error(w, "Can't create feed token", http.StatusInternalServerError)
+		return
+	}
+	s.db.Update(user.UserId, func(user *db.User) {
+		user.FeedToken = token
+	})
+	if err := s.db.Save(); err != nil {
+		slog.Error("db save failed", "error", err)
+	}
+	slog.Info("feed token changed", "user_id", user.UserId)
+	http.Redirect(w, r, "/dashboard?saved", http.StatusSeeOther)
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/spotify"
+)
+
+func newFeedServer(t *testing.T) (*Server, *http.ServeMux) {
+	s := newTestServer(t)
+	s.db.Update(1, func(user *db.User) { user.FeedToken = "feedtoken" })
+	album := spotify.Album{
+		Id:          "album",
+		Name:        "Album & Co",
+		AlbumType:   "single",
+		Url:         "https://open.spotify.com/album/album",
+		Uri:         "spotify:album:album",
+		ImageUrl:    "https://i.scdn.co/image/cover",
+		ReleaseDate: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		Artists:     []spotify.Artist{{Id: "a", Name: "First"}, {Id: "b", Name: "Second"}},
+	}
+	s.db.AddNotification(db.Notification{UserId: 1, Sent: time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC), Album: album})
+	// The same release found again and a release of another user
+	s.db.AddNotification(db.Notification{UserId: 1, Sent: time.Date(2024, 3, 3, 10, 0, 0, 0, time.UTC), Album: album})
+	s.db.AddNotification(db.Notification{UserId: 2, Album: spotify.Album{Id: "other", Name: "Other"}})
+	// Not delivered releases are not in feeds
+	s.db.AddNotification(db.Notification{UserId: 1, Sent: time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC),
+		Album: spotify.Album{Id: "failed", Name: "Failed"}, Error: "chat not found"})
+
+	mux := http.NewServeMux()
+	s.handleWeb(mux)
+	return s, mux
+}
+
+func Test_handleFeeds(t *testing.T) {
+	_, mux := newFeedServer(t)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{name: "atom", path: "/feeds/feedtoken/atom.xml", wantStatus: http.StatusOK},
+		{name: "rss", path: "/feeds/feedtoken/rss.xml", wantStatus: http.StatusOK},
+		{name: "wrong token", path: "/feeds/wrong/atom.xml", wantStatus: http.StatusNotFound},
+		{name: "no token", path: "/feeds/atom.xml", wantStatus: http.StatusNotFound},
+		{name: "unknown feed", path: "/feeds/feedtoken/feed.json", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func Test_atomFeed(t *testing.T) {
+	_, mux := newFeedServer(t)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/feeds/feedtoken/atom.xml", nil))
+
+	feed := atomFeed{}
+	if err := xml.Unmarshal(recorder.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("atom feed is not valid XML: %v", err)
+	}
+	if len(feed.Entries) != 1 {
+		t.Fatalf("atom feed has %d entries, want 1", len(feed.Entries))
+	}
+	entry := feed.Entries[0]
+	if entry.Title != "First, Second – Album & Co" || entry.Updated != "2024-03-03T10:00:00Z" {
+		t.Errorf("entry = %+v", entry)
+	}
+	if len(entry.Authors) != 2 || entry.Categories[0].Term != "single" {
+		t.Errorf("entry authors = %v, categories = %v", entry.Authors, entry.Categories)
+	}
+	if len(entry.Links) != 2 || entry.Links[1].Rel != "enclosure" || entry.Links[1].Href != "https://i.scdn.co/image/cover" {
+		t.Errorf("entry links = %+v", entry.Links)
+	}
+	if !strings.Contains(entry.Content.Body, "Released: 2024-03-01") {
+		t.Errorf("entry content = %s", entry.Content.Body)
+	}
+}
+
+func Test_rssFeed(t *testing.T) {
+	_, mux := newFeedServer(t)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/feeds/feedtoken/rss.xml", nil))
+
+	feed := rssFeed{}
+	if err := xml.Unmarshal(recorder.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("rss feed is not valid XML: %v", err)
+	}
+	if len(feed.Channel.Items) != 1 {
+		t.Fatalf("rss feed has %d items, want 1", len(feed.Channel.Items))
+	}
+	item := feed.Channel.Items[0]
+	if item.Link != "https://open.spotify.com/album/album" || item.Guid.Value != "spotify:album:album" || item.Category != "single" {
+		t.Errorf("item = %+v", item)
+	}
+	if item.Enclosure == nil || item.Enclosure.Url != "https://i.scdn.co/image/cover" {
+		t.Errorf("item enclosure = %+v", item.Enclosure)
+	}
+}
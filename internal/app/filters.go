@@ -0,0 +1,106 @@
+package app
+
+import (
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/spotify"
+)
+
+// filterAlbums drops releases of muted artists, releases of unwanted types
+// and groups, and releases dropped by the title rules. Track titles are looked
+// up only for releases passing the other filters and only if there are track
+// rules, tracks may be nil otherwise. It returns kept albums and the number of
+// dropped ones
+func filterAlbums(settings db.Settings, rules []titleRule, albums []spotify.Album, tracks func(spotify.Album) []string) ([]spotify.Album, int) {
+	lookupTracks := tracks != nil && hasTrackRules(rules)
+	kept := make([]spotify.Album, 0, len(albums))
+	for _, album := range albums {
+		if excluded(settings, album) || excludedByTitle(rules, album) {
+			continue
+		}
+		var titles []string
+		if lookupTracks {
+			titles = tracks(album)
+		}
+		if ok, _ := titleVerdict(rules, album, titles); !ok {
+			continue
+		}
+		kept = append(kept, album)
+	}
+	return kept, len(albums) - len(kept)
+}
+
+// albumLevel returns the level of the release. A priority artist anywhere in
+// the release makes it priority. Otherwise the highest level of followed
+// artists of the release decides, or the level of the main artist if they are
+// unknown
+func albumLevel(settings db.Settings, album spotify.Album) string {
+	for _, artists := range [][]spotify.Artist{album.Artists, album.Followed} {
+		for _, artist := range artists {
+			if settings.ArtistLevel(artist.Id) == db.LevelPriority {
+				return db.LevelPriority
+			}
+		}
+	}
+	deciding := album.Followed
+	if len(deciding) == 0 && len(album.Artists) > 0 {
+		deciding = album.Artists[:1]
+	}
+	if len(deciding) == 0 {
+		return db.LevelNormal
+	}
+	level := db.LevelMuted
+	for _, artist := range deciding {
+		if artistLevel := settings.ArtistLevel(artist.Id); levelRank(artistLevel) > levelRank(level) {
+			level = artistLevel
+		}
+	}
+	return level
+}
+
+// levelRank orders levels from muted to priority
+func levelRank(level string) int {
+	for i, l := range db.Levels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// typeAllowed checks the album type against the types chosen for the level
+// of the release
+func typeAllowed(settings db.Settings, album spotify.Album, level string) bool {
+	types := settings.AlbumTypes
+	if level == db.LevelPriority {
+		types = settings.PriorityAlbumTypes
+	}
+	return len(types) == 0 || contains(types, album.AlbumType)
+}
+
+// mainArtistFollowed tells if a followed artist is the main artist of the
+// release. Releases without known followed artists pass
+func mainArtistFollowed(album spotify.Album) bool {
+	if len(album.Followed) == 0 || len(album.Artists) == 0 {
+		return true
+	}
+	for _, artist := range album.Followed {
+		if artist.Id == album.Artists[0].Id {
+			return true
+		}
+	}
+	return false
+}
+
+func excluded(settings db.Settings, album spotify.Album) bool {
+	level := albumLevel(settings, album)
+	if level == db.LevelMuted || !typeAllowed(settings, album, level) {
+		return true
+	}
+	if len(settings.IncludeGroups) > 0 && album.AlbumGroup != "" && !contains(settings.IncludeGroups, album.AlbumGroup) {
+		return true
+	}
+	if settings.MainArtistOnly && !mainArtistFollowed(album) {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/spotify"
+)
+
+func Test_filterAlbums(t *testing.T) {
+	settings := db.Settings{TitleRules: []db.TitleRule{{Action: db.RuleExclude, Field: db.RuleAlbum, Pattern: "Remix"}}}
+	settings.SetArtistLevel("muted", "Muted", db.LevelMuted)
+	albums := []spotify.Album{
+		{Name: "Album", Artists: []spotify.Artist{{Id: "a"}}},
+		{Name: "Song (remix)", Artists: []spotify.Artist{{Id: "a"}}},
+		{Name: "Album", Artists: []spotify.Artist{{Id: "muted"}}},
+		{Name: "Feature", Artists: []spotify.Artist{{Id: "a"}, {Id: "muted"}}},
+	}
+
+	kept, filtered := filterAlbums(settings, titleRules(settings), albums, nil)
+	if filtered != 2 || len(kept) != 2 || kept[1].Name != "Feature" {
+		t.Errorf("filterAlbums() = %+v, %d", kept, filtered)
+	}
+}
+
+func Test_albumLevel(t *testing.T) {
+	settings := db.Settings{}
+	settings.SetArtistLevel("muted", "Muted", db.LevelMuted)
+	settings.SetArtistLevel("silent", "Silent", db.LevelSilent)
+	settings.SetArtistLevel("priority", "Priority", db.LevelPriority)
+
+	tests := []struct {
+		name     string
+		artists  []string
+		followed []string
+		want     string
+	}{
+		{name: "no artists", want: db.LevelNormal},
+		{name: "main artist", artists: []string{"silent", "other"}, want: db.LevelSilent},
+		{name: "featured artist", artists: []string{"other", "muted"}, want: db.LevelNormal},
+		{name: "featured priority", artists: []string{"muted", "priority"}, want: db.LevelPriority},
+		{name: "followed feature muted", artists: []string{"other"}, followed: []string{"muted"}, want: db.LevelMuted},
+		{name: "followed feature silent", artists: []string{"other"}, followed: []string{"silent"}, want: db.LevelSilent},
+		{name: "followed feature priority", artists: []string{"other"}, followed: []string{"priority"}, want: db.LevelPriority},
+		{name: "highest followed", artists: []string{"muted", "other"}, followed: []string{"muted", "silent"}, want: db.LevelSilent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			album := spotify.Album{}
+			for _, id := range tt.artists {
+				album.Artists = append(album.Artists, spotify.Artist{Id: id})
+			}
+			for _, id := range tt.followed {
+				album.Followed = append(album.Followed, spotify.Artist{Id: id})
+			}
+			if got := albumLevel(settings, album); got != tt.want {
+				t.Errorf("albumLevel() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_filterAlbumTypes(t *testing.T) {
+	followed := spotify.Artist{Id: "followed"}
+	release := func(albumType, group string, artists ...spotify.Artist) spotify.Album {
+		return spotify.Album{Name: albumType, AlbumType: albumType, AlbumGroup: group, Artists: artists, Followed: []spotify.Artist{followed}}
+	}
+	settings := db.Settings{
+		IncludeGroups:  []string{spotify.GroupAlbum, spotify.GroupSingle, spotify.GroupAppearsOn},
+		AlbumTypes:     []string{spotify.GroupAlbum},
+		MainArtistOnly: true,
+	}
+	settings.SetArtistLevel("priority", "Priority", db.LevelPriority)
+
+	tests := []struct {
+		name  string
+		album spotify.Album
+		want  bool
+	}{
+		{name: "album", album: release("album", "album", followed), want: true},
+		{name: "single", album: release("single", "single", followed), want: false},
+		{name: "single of priority artist", album: release("single", "single", followed, spotify.Artist{Id: "priority"}), want: true},
+		{name: "compilation group", album: release("album", "compilation", followed), want: false},
+		{name: "feature", album: release("album", "appears_on", spotify.Artist{Id: "other"}, followed), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, _ := filterAlbums(settings, titleRules(settings), []spotify.Album{tt.album}, nil)
+			if (len(kept) == 1) != tt.want {
+				t.Errorf("filterAlbums() kept = %v, want %v", len(kept) == 1, tt.want)
+			}
+		})
+	}
+}
+
+func Test_filterAlbums_tracks(t *testing.T) {
+	settings := db.Settings{TitleRules: []db.TitleRule{
+		{Action: db.RuleExclude, Field: db.RuleAlbum, Pattern: "karaoke"},
+		{Action: db.RuleExclude, Field: db.RuleTrack, Pattern: "instrumental"},
+	}}
+	settings.SetArtistLevel("muted", "Muted", db.LevelMuted)
+	albums := []spotify.Album{
+		{Id: "1", Name: "Album"},
+		{Id: "2", Name: "Album (Karaoke)"},
+		{Id: "3", Name: "Other"},
+		{Id: "4", Name: "Muted", Artists: []spotify.Artist{{Id: "muted"}}},
+	}
+	var requested []string
+	tracks := func(album spotify.Album) []string {
+		requested = append(requested, album.Id)
+		if album.Id == "3" {
+			return []string{"Song", "Song (Instrumental)"}
+		}
+		return nil
+	}
+
+	kept, filtered := filterAlbums(settings, titleRules(settings), albums, tracks)
+	if len(kept) != 1 || kept[0].Id != "1" || filtered != 3 {
+		t.Errorf("filterAlbums() = %+v, %d", kept, filtered)
+	}
+	// Tracks of muted and excluded releases are not requested
+	if fmt.Sprint(requested) != "[1 3]" {
+		t.Errorf("tracks requested for %v", requested)
+	}
+
+	requested = nil
+	settings.TitleRules = nil
+	filterAlbums(settings, titleRules(settings), albums, tracks)
+	if len(requested) != 0 {
+		t.Errorf("tracks requested without track rules for %v", requested)
+	}
+}
@@ -0,0 +1,257 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/scheduler"
+)
+
+// Time for a scheduled check to start and finish after the planned time
+const checkSlack = time.Hour
+
+// Slack added to the long polling timeout before the loop counts as stuck
+const pollSlack = time.Minute
+
+// getMe is asked again by /readyz once its result is older than this
+const getMeTTL = time.Minute
+const getMeTimeout = 10 * time.Second
+
+// health keeps the state reported by /healthz and /readyz
+type health struct {
+	mu          sync.Mutex
+	started     time.Time
+	dbLoaded    bool
+	botUsername string
+	getMeErr    error
+	getMeAt     time.Time
+	// Every finished iteration of the polling loop, failed ones too
+	lastPoll time.Time
+	// Successful fetches of updates from Telegram
+	lastUpdates time.Time
+	updatesErr  error
+	lastCheck   time.Time
+	now         func() time.Time
+}
+
+func newHealth() *health {
+	return &health{started: time.Now(), now: time.Now}
+}
+
+func (h *health) setDBLoaded() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dbLoaded = true
+}
+
+func (h *health) setGetMe(username string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.botUsername = username
+	h.getMeErr = err
+	h.getMeAt = h.now()
+}
+
+// probeGetMe asks getMe again if the last result is outdated, so recovery
+// after a failure is reported. Concurrent callers don't repeat the request
+func (h *health) probeGetMe(getMe func() (string, error)) {
+	h.mu.Lock()
+	if !h.getMeAt.IsZero() && h.now().Sub(h.getMeAt) < getMeTTL {
+		h.mu.Unlock()
+		return
+	}
+	h.getMeAt = h.now()
+	h.mu.Unlock()
+	h.setGetMe(getMe())
+}
+
+// polled records an iteration of the polling loop and its result
+func (h *health) polled(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastPoll = h.now()
+	h.updatesErr = err
+	if err == nil {
+		h.lastUpdates = h.lastPoll
+	}
+}
+
+func (h *health) checked(t time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if t.After(h.lastCheck) {
+		h.lastCheck = t
+	}
+}
+
+// checkSchedule is a schedule of automatic checks in the timezone of the user
+type checkSchedule struct {
+	schedule scheduler.Schedule
+	location *time.Location
+}
+
+// missedRun tells whether the schedule planned two runs after the last
+// successful check which are both over, so one failed or slow run is allowed
+func (c checkSchedule) missedRun(lastCheck, now time.Time, slack time.Duration) bool {
+	next := c.schedule.Next(lastCheck.In(c.location))
+	if next.IsZero() {
+		return false
+	}
+	next = c.schedule.Next(next)
+	return !next.IsZero() && now.After(next.Add(slack))
+}
+
+type probe struct {
+	Name   string `json:"name"`
+	Ok     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type healthReport struct {
+	Status string  `json:"status"`
+	Probes []probe `json:"checks"`
+}
+
+func (r *healthReport) add(name string, ok bool, detail string) {
+	r.Probes = append(r.Probes, probe{Name: name, Ok: ok, Detail: detail})
+	if !ok {
+		r.Status = "fail"
+	}
+}
+
+// since returns the time passed after the event. Before the first event the
+// time since start is used, so startup is not a failure
+func (h *health) since(last time.Time) time.Duration {
+	if last.IsZero() {
+		last = h.started
+	}
+	return h.now().Sub(last)
+}
+
+// polling reports whether the polling loop goes on, failed fetches included
+func (h *health) polling(report *healthReport, pollTimeout time.Duration) {
+	age := h.since(h.lastPoll)
+	report.add("polling", age <= pollTimeout+pollSlack, fmt.Sprintf("last loop iteration %s ago", age.Round(time.Second)))
+}
+
+// updates reports whether updates were fetched from Telegram recently
+func (h *health) updates(report *healthReport, pollTimeout time.Duration) {
+	age := h.since(h.lastUpdates)
+	detail := fmt.Sprintf("last update fetch %s ago", age.Round(time.Second))
+	if h.updatesErr != nil {
+		detail += ": " + h.updatesErr.Error()
+	}
+	report.add("telegram_updates", age <= pollTimeout+pollSlack, detail)
+}
+
+// live reports whether the bot is not stuck and should not be restarted
+func (h *health) live(pollTimeout time.Duration) healthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	report := healthReport{Status: "ok"}
+	h.polling(&report, pollTimeout)
+	return report
+}
+
+// ready reports whether the bot is able to send notifications. Checks are
+// expected according to the schedules of automatic checks
+func (h *health) ready(pollTimeout time.Duration, users []db.User, schedules []checkSchedule, slack time.Duration) healthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	report := healthReport{Status: "ok"}
+	report.add("db", h.dbLoaded, "")
+
+	switch {
+	case h.getMeErr != nil:
+		report.add("telegram", false, h.getMeErr.Error())
+	case h.botUsername == "":
+		report.add("telegram", false, "getMe not done")
+	default:
+		report.add("telegram", true, "@"+h.botUsername)
+	}
+
+	valid := 0
+	for _, user := range users {
+		if user.Token.RefreshToken != "" || !user.Token.Expired() {
+			valid++
+		}
+	}
+	report.add("spotify_token", valid > 0, fmt.Sprintf("%d of %d users with a valid token", valid, len(users)))
+
+	h.updates(&report, pollTimeout)
+
+	switch {
+	case len(schedules) == 0:
+		report.add("last_check", true, "no automatic checks")
+	case h.lastCheck.IsZero():
+		report.add("last_check", false, "no successful check")
+	default:
+		missed := 0
+		for _, schedule := range schedules {
+			if schedule.missedRun(h.lastCheck, h.now(), slack) {
+				missed++
+			}
+		}
+		detail := h.lastCheck.UTC().Format(time.RFC3339)
+		if missed > 0 {
+			detail += fmt.Sprintf(", %d schedules missed runs", missed)
+		}
+		report.add("last_check", missed == 0, detail)
+	}
+	return report
+}
+
+func writeReport(w http.ResponseWriter, report healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+func (s *Server) pollTimeout() time.Duration {
+	return time.Duration(s.config.Telegram.Timeout) * time.Second
+}
+
+// healthz is the liveness probe, it fails when the polling loop hangs
+func (s *Server) healthz(w http.ResponseWriter, _ *http.Request) {
+	writeReport(w, s.health.live(s.pollTimeout()))
+}
+
+// checkSchedules returns schedules of automatic checks of users who have them
+func (s *Server) checkSchedules(users []db.User) []checkSchedule {
+	var schedules []checkSchedule
+	for i := range users {
+		schedule, _ := s.userSchedule(&users[i])
+		if schedule != nil {
+			schedules = append(schedules, checkSchedule{schedule: schedule, location: users[i].Settings.Location()})
+		}
+	}
+	return schedules
+}
+
+// getMe returns the username of the bot
+func (s *Server) getMe(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, getMeTimeout)
+	defer cancel()
+	me, err := s.bot.GetMe(ctx)
+	if err != nil {
+		return "", err
+	}
+	return me.Username, nil
+}
+
+// readyz is the readiness probe covering everything needed for notifications
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	s.health.probeGetMe(func() (string, error) { return s.getMe(r.Context()) })
+	users := s.db.Users()
+	slack := checkSlack + time.Duration(s.config.Scheduler.JitterSeconds)*time.Second
+	writeReport(w, s.health.ready(s.pollTimeout(), users, s.checkSchedules(users), slack))
+}
@@ -0,0 +1,213 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/scheduler"
+	"TeleBotNotifications/internal/spotify"
+)
+
+func probeResults(report healthReport) map[string]bool {
+	results := make(map[string]bool)
+	for _, p := range report.Probes {
+		results[p.Name] = p.Ok
+	}
+	return results
+}
+
+func Test_healthReady(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	validUser := []db.User{{Token: spotify.OAuth2Token{RefreshToken: "refresh", Expires: now.Add(-time.Hour)}}}
+	ready := func(h *health) {
+		h.setDBLoaded()
+		h.setGetMe("bot", nil)
+		h.polled(nil)
+	}
+
+	tests := []struct {
+		name      string
+		setup     func(h *health)
+		users     []db.User
+		schedules []string
+		failed    []string
+	}{
+		{
+			name: "ready",
+			setup: func(h *health) {
+				h.setDBLoaded()
+				h.setGetMe("bot", nil)
+				h.polled(nil)
+				h.checked(now.Add(-25 * time.Hour))
+			},
+			users:     validUser,
+			schedules: []string{"@daily"},
+		},
+		{
+			name:      "nothing done",
+			setup:     func(h *health) {},
+			schedules: []string{"@daily"},
+			failed:    []string{"db", "telegram", "spotify_token", "last_check"},
+		},
+		{
+			name:  "no automatic checks",
+			setup: ready,
+			users: validUser,
+		},
+		{
+			name: "weekly schedule",
+			setup: func(h *health) {
+				ready(h)
+				h.checked(now.AddDate(0, 0, -6))
+			},
+			users:     validUser,
+			schedules: []string{"@weekly"},
+		},
+		{
+			name: "weekly schedule missed runs",
+			setup: func(h *health) {
+				ready(h)
+				h.checked(now.AddDate(0, 0, -15))
+			},
+			users:     validUser,
+			schedules: []string{"@weekly"},
+			failed:    []string{"last_check"},
+		},
+		{
+			name: "shortest schedule missed runs",
+			setup: func(h *health) {
+				ready(h)
+				h.checked(now.AddDate(0, 0, -3))
+			},
+			users:     validUser,
+			schedules: []string{"@weekly", "@daily"},
+			failed:    []string{"last_check"},
+		},
+		{
+			name: "getMe failed and stale check",
+			setup: func(h *health) {
+				h.setDBLoaded()
+				h.setGetMe("", errors.New("unauthorized"))
+				h.checked(now.Add(-72 * time.Hour))
+			},
+			users:     validUser,
+			schedules: []string{"@daily"},
+			failed:    []string{"telegram", "last_check"},
+		},
+		{
+			name: "token can't be refreshed",
+			setup: func(h *health) {
+				h.setDBLoaded()
+				h.setGetMe("bot", nil)
+				h.checked(now)
+			},
+			users:  []db.User{{Token: spotify.OAuth2Token{Expires: now.Add(-time.Hour)}}},
+			failed: []string{"spotify_token"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &health{started: now, now: func() time.Time { return now }}
+			tt.setup(h)
+			var schedules []checkSchedule
+			for _, spec := range tt.schedules {
+				schedule, err := scheduler.Parse(spec)
+				if err != nil {
+					t.Fatal(err)
+				}
+				schedules = append(schedules, checkSchedule{schedule: schedule, location: time.UTC})
+			}
+			report := h.ready(time.Minute, tt.users, schedules, checkSlack)
+
+			results := probeResults(report)
+			for _, name := range tt.failed {
+				if results[name] {
+					t.Errorf("ready() probe %s passed, want failure", name)
+				}
+				delete(results, name)
+			}
+			for name, ok := range results {
+				if !ok {
+					t.Errorf("ready() probe %s failed", name)
+				}
+			}
+			if wantStatus := map[bool]string{true: "ok", false: "fail"}[len(tt.failed) == 0]; report.Status != wantStatus {
+				t.Errorf("ready() status = %s, want %s", report.Status, wantStatus)
+			}
+		})
+	}
+}
+
+func Test_healthLive(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	h := &health{started: now, now: func() time.Time { return now }}
+
+	// Grace period before the first poll
+	now = now.Add(90 * time.Second)
+	if report := h.live(time.Minute); report.Status != "ok" {
+		t.Errorf("live() before first poll = %+v", report)
+	}
+
+	h.polled(nil)
+	now = now.Add(3 * time.Minute)
+	report := h.live(time.Minute)
+	if report.Status != "fail" {
+		t.Errorf("live() with stuck polling = %+v", report)
+	}
+
+	recorder := httptest.NewRecorder()
+	writeReport(recorder, report)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("writeReport() status code = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func Test_healthTelegramOutage(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	h := &health{started: now, now: func() time.Time { return now }}
+	h.polled(nil)
+
+	// The loop goes on while fetches fail, so the bot is alive but not ready
+	for i := 0; i < 5; i++ {
+		now = now.Add(time.Minute)
+		h.polled(errors.New("telegram update fetch failed"))
+	}
+	if report := h.live(time.Minute); report.Status != "ok" {
+		t.Errorf("live() during an outage = %+v", report)
+	}
+	if results := probeResults(h.ready(time.Minute, nil, nil, checkSlack)); results["telegram_updates"] {
+		t.Errorf("ready() probe telegram_updates passed during an outage")
+	}
+
+	now = now.Add(time.Minute)
+	h.polled(nil)
+	if results := probeResults(h.ready(time.Minute, nil, nil, checkSlack)); !results["telegram_updates"] {
+		t.Errorf("ready() probe telegram_updates failed after the outage")
+	}
+}
+
+func Test_healthGetMeRecovery(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	h := &health{started: now, now: func() time.Time { return now }}
+	h.setGetMe("", errors.New("connection reset"))
+
+	calls := 0
+	getMe := func() (string, error) {
+		calls++
+		return "bot", nil
+	}
+	h.probeGetMe(getMe)
+	if results := probeResults(h.ready(time.Minute, nil, nil, checkSlack)); results["telegram"] || calls != 0 {
+		t.Errorf("ready() probe telegram = %v after %d calls, want the cached failure", results["telegram"], calls)
+	}
+
+	now = now.Add(getMeTTL)
+	h.probeGetMe(getMe)
+	if results := probeResults(h.ready(time.Minute, nil, nil, checkSlack)); !results["telegram"] || calls != 1 {
+		t.Errorf("ready() probe telegram = %v after %d calls, want recovery", results["telegram"], calls)
+	}
+}
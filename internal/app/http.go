@@ -0,0 +1,67 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"TeleBotNotifications/internal/metrics"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+var (
+	checkDuration = metrics.NewHistogramVec("check_duration_seconds",
+		"Duration of checks for new releases.", []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600})
+	checksTotal = metrics.NewCounterVec("checks_total",
+		"Checks for new releases by result.", "result")
+	releasesFoundTotal = metrics.NewCounterVec("releases_found_total",
+		"New releases found by checks.")
+)
+
+func (s *Server) newHTTPServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	s.handleWeb(mux)
+	if s.config.Admin.Token != "" {
+		mux.Handle("/api/", s.adminAPI())
+	} else {
+		slog.Info("admin api disabled, ADMIN_TOKEN is not set")
+	}
+
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", s.config.Port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// serveHTTP runs the server until the context is canceled
+func (s *Server) serveHTTP(ctx context.Context) {
+	server := s.newHTTPServer()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		<-ctx.Done()
+		shutdownContext, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownContext); err != nil {
+			slog.Error("http server shutdown failed", "error", err)
+		}
+	}()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		slog.Info("http server started", "addr", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("http server failed", "error", err)
+		}
+	}()
+}
@@ -0,0 +1,304 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/spotify"
+	"TeleBotNotifications/internal/telegram"
+	"TeleBotNotifications/internal/telegram/format"
+)
+
+// Sent releases checked by /rules test
+const testedReleases = 20
+
+// titleRule is a title rule ready for matching
+type titleRule struct {
+	db.TitleRule
+	re *regexp.Regexp
+}
+
+func compileRule(rule db.TitleRule) (titleRule, error) {
+	compiled := titleRule{TitleRule: rule}
+	if rule.Action != db.RuleInclude && rule.Action != db.RuleExclude {
+		return compiled, fmt.Errorf("unknown action %q, expected %s or %s", rule.Action, db.RuleInclude, db.RuleExclude)
+	}
+	if rule.Field != db.RuleAlbum && rule.Field != db.RuleTrack {
+		return compiled, fmt.Errorf("unknown field %q, expected %s or %s", rule.Field, db.RuleAlbum, db.RuleTrack)
+	}
+	if rule.Pattern == "" {
+		return compiled, fmt.Errorf("empty pattern")
+	}
+	if rule.Regex {
+		var err error
+		compiled.re, err = regexp.Compile("(?i)" + rule.Pattern)
+		if err != nil {
+			return compiled, fmt.Errorf("wrong regular expression: %w", err)
+		}
+	}
+	return compiled, nil
+}
+
+func (r titleRule) match(title string) bool {
+	if r.re != nil {
+		return r.re.MatchString(title)
+	}
+	return strings.Contains(strings.ToLower(title), strings.ToLower(r.Pattern))
+}
+
+// matchRelease checks the album title or any of the track titles
+func (r titleRule) matchRelease(album spotify.Album, tracks []string) bool {
+	if r.Field == db.RuleAlbum {
+		return r.match(album.Name)
+	}
+	for _, track := range tracks {
+		if r.match(track) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeRule shows the rule the way /rules add takes it
+func describeRule(rule db.TitleRule) string {
+	pattern := strconv.Quote(rule.Pattern)
+	if rule.Regex {
+		pattern = "/" + rule.Pattern + "/"
+	}
+	return fmt.Sprintf("%s %s %s", rule.Action, rule.Field, pattern)
+}
+
+// titleRules compiles title rules of the settings. Broken rules are skipped
+func titleRules(settings db.Settings) []titleRule {
+	rules := make([]titleRule, 0, len(settings.TitleRules))
+	for _, rule := range settings.TitleRules {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			slog.Warn("broken title rule skipped", "rule", describeRule(rule), "error", err)
+			continue
+		}
+		rules = append(rules, compiled)
+	}
+	return rules
+}
+
+func hasTrackRules(rules []titleRule) bool {
+	for _, rule := range rules {
+		if rule.Field == db.RuleTrack {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedByTitle tells if an exclude rule matches the album title. Such
+// releases are dropped without looking up their tracks
+func excludedByTitle(rules []titleRule, album spotify.Album) bool {
+	for _, rule := range rules {
+		if rule.Action == db.RuleExclude && rule.Field == db.RuleAlbum && rule.match(album.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// titleVerdict tells if the release passes the rules and why it doesn't. A
+// matching exclude rule drops the release. If there are include rules, the
+// release must match one of them
+func titleVerdict(rules []titleRule, album spotify.Album, tracks []string) (bool, string) {
+	includes, included := 0, false
+	for _, rule := range rules {
+		if rule.Action == db.RuleInclude {
+			includes++
+			included = included || rule.matchRelease(album, tracks)
+			continue
+		}
+		if rule.matchRelease(album, tracks) {
+			return false, describeRule(rule.TitleRule)
+		}
+	}
+	if includes > 0 && !included {
+		return false, "no include rule matched"
+	}
+	return true, ""
+}
+
+// trackTitles returns a lookup of track titles of releases. Releases with
+// failed requests are matched by the album title only
+func (s *Server) trackTitles(ctx context.Context, user *db.User) func(spotify.Album) []string {
+	return func(album spotify.Album) []string {
+		if ctx.Err() != nil {
+			return nil
+		}
+		tracks, err := s.spotifyClient.GetAlbumTracks(&user.Token, album.Id, 50, 0, nil, ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "tracks for title rules not received", "album_id", album.Id, "error", err)
+			return nil
+		}
+		titles := make([]string, 0, len(tracks))
+		for _, track := range tracks {
+			titles = append(titles, track.Name)
+		}
+		return titles
+	}
+}
+
+// parseRule reads a rule like "exclude track /live at .*/". The field is
+// album if omitted, patterns between slashes are regular expressions and
+// quoted patterns are taken as describeRule writes them
+func parseRule(text string) (db.TitleRule, error) {
+	action, rest, _ := strings.Cut(strings.TrimSpace(text), " ")
+	rule := db.TitleRule{Action: action, Field: db.RuleAlbum}
+	rest = strings.TrimSpace(rest)
+	if field, pattern, ok := strings.Cut(rest, " "); ok && (field == db.RuleAlbum || field == db.RuleTrack) {
+		rule.Field, rest = field, strings.TrimSpace(pattern)
+	}
+	if len(rest) > 2 && strings.HasPrefix(rest, "/") && strings.HasSuffix(rest, "/") {
+		rule.Regex, rest = true, rest[1:len(rest)-1]
+	} else if unquoted, err := strconv.Unquote(rest); err == nil && strings.HasPrefix(rest, `"`) {
+		rest = unquoted
+	}
+	rule.Pattern = rest
+	_, err := compileRule(rule)
+	return rule, err
+}
+
+// parseRules reads rules of the dashboard, one per line. A line with only a
+// text excludes releases with it in the title
+func parseRules(text string) ([]db.TitleRule, error) {
+	var rules []db.TitleRule
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if action, _, _ := strings.Cut(line, " "); action != db.RuleInclude && action != db.RuleExclude {
+			line = db.RuleExclude + " " + line
+		}
+		rule, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// rulesText shows rules on the dashboard the way parseRules reads them
+func rulesText(settings db.Settings) string {
+	lines := make([]string, 0, len(settings.TitleRules))
+	for _, rule := range settings.TitleRules {
+		lines = append(lines, describeRule(rule))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func rulesList(settings db.Settings) *format.Builder {
+	text := format.New(format.MarkdownV2)
+	if len(settings.TitleRules) == 0 {
+		text.Text("No title rules")
+	} else {
+		text.Bold("Title rules")
+		for i, rule := range settings.TitleRules {
+			text.Line("").Text(fmt.Sprintf("%d. ", i+1)).Code(describeRule(rule))
+		}
+	}
+	return text.Line("").Line("").
+		Text("Add a rule with ").Code("/rules add exclude /sped ?up/").
+		Text(" or ").Code("/rules add include track remix").
+		Text(", remove it with ").Code("/rules delete 1").
+		Text(" and try the rules on recent releases with ").Code("/rules test")
+}
+
+// testRules runs the rules against releases sent recently
+func (s *Server) testRules(user *db.User) *format.Builder {
+	var albums []spotify.Album
+	seen := make(map[string]bool)
+	for _, notification := range s.db.Notifications(user.UserId, 0) {
+		if len(albums) == testedReleases {
+			break
+		}
+		if !seen[notification.Album.Id] {
+			seen[notification.Album.Id] = true
+			albums = append(albums, notification.Album)
+		}
+	}
+	text := format.New(format.MarkdownV2)
+	if len(albums) == 0 {
+		return text.Text("No releases were sent yet")
+	}
+
+	rules := titleRules(user.Settings)
+	tracks := s.trackTitles(context.Background(), user)
+	var dropped int
+	for _, album := range albums {
+		var titles []string
+		if hasTrackRules(rules) {
+			titles = tracks(album)
+		}
+		kept, reason := titleVerdict(rules, album, titles)
+		if kept {
+			continue
+		}
+		dropped++
+		text.Line("").Text("✗ ").Bold(album.Name).Text(" · " + releaseArtists(album) + ": ").Italic(reason)
+	}
+	return format.New(format.MarkdownV2).
+		Text(fmt.Sprintf("Of %d recent releases %d would be filtered out", len(albums), dropped)).
+		Append(text)
+}
+
+// Rules lists, adds, deletes and tests title rules of the user
+func (s *Server) Rules(message telegram.ReceivedMessage) error {
+	user := s.db.Get(message.UserId)
+	if user == nil {
+		return errNoUser
+	}
+
+	var text *format.Builder
+	command, argument, _ := strings.Cut(message.Text, " ")
+	switch command {
+	case "":
+		text = rulesList(user.Settings)
+	case "add":
+		rule, err := parseRule(argument)
+		if err != nil {
+			return telegram.NewUserError("Wrong rule: %s. Use /rules add <include|exclude> [album|track] <text or /regex/>", err)
+		}
+		s.updateSettings(user.UserId, func(settings *db.Settings) {
+			settings.TitleRules = append(settings.TitleRules, rule)
+		})
+		slog.Info("title rule added", "user_id", user.UserId, "rule", describeRule(rule))
+		text = format.New(format.MarkdownV2).Text("Added ").Code(describeRule(rule))
+	case "delete":
+		number, err := strconv.Atoi(strings.TrimSpace(argument))
+		if err != nil || number < 1 || number > len(user.Settings.TitleRules) {
+			return telegram.NewUserError("No rule %q, see /rules for numbers", argument)
+		}
+		rule := user.Settings.TitleRules[number-1]
+		s.updateSettings(user.UserId, func(settings *db.Settings) {
+			if number <= len(settings.TitleRules) {
+				settings.TitleRules = append(settings.TitleRules[:number-1:number-1], settings.TitleRules[number:]...)
+			}
+		})
+		slog.Info("title rule deleted", "user_id", user.UserId, "rule", describeRule(rule))
+		text = format.New(format.MarkdownV2).Text("Deleted ").Code(describeRule(rule))
+	case "test":
+		text = s.testRules(user)
+	default:
+		return telegram.NewUserError("Unknown action %q, use /rules add, /rules delete or /rules test", command)
+	}
+
+	reply := telegram.FormattedMessage(text)
+	reply.ChatId = message.ChatId
+	_, err := s.bot.SendMessage(reply)
+	if err != nil {
+		return fmt.Errorf("error sending title rules: %w", err)
+	}
+	return nil
+}
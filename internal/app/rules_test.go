@@ -0,0 +1,92 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/spotify"
+)
+
+func Test_parseRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    db.TitleRule
+		wantErr bool
+	}{
+		{name: "text", text: "exclude sped up", want: db.TitleRule{Action: db.RuleExclude, Field: db.RuleAlbum, Pattern: "sped up"}},
+		{name: "track regex", text: "include track /remix|edit/", want: db.TitleRule{Action: db.RuleInclude, Field: db.RuleTrack, Pattern: "remix|edit", Regex: true}},
+		{name: "album word in pattern", text: "exclude album", want: db.TitleRule{Action: db.RuleExclude, Field: db.RuleAlbum, Pattern: "album"}},
+		{name: "quoted", text: `exclude album "sped up"`, want: db.TitleRule{Action: db.RuleExclude, Field: db.RuleAlbum, Pattern: "sped up"}},
+		{name: "unknown action", text: "drop live", wantErr: true},
+		{name: "empty pattern", text: "exclude", wantErr: true},
+		{name: "wrong regex", text: "exclude /(live/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRule(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRule(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseRule(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_titleVerdict(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []db.TitleRule
+		album  string
+		tracks []string
+		want   bool
+	}{
+		{name: "no rules", album: "Album", want: true},
+		{name: "excluded text", rules: []db.TitleRule{{Action: db.RuleExclude, Field: db.RuleAlbum, Pattern: "SPED UP"}}, album: "Song (Sped Up)"},
+		{name: "excluded regex", rules: []db.TitleRule{{Action: db.RuleExclude, Field: db.RuleAlbum, Pattern: `^live\b`, Regex: true}}, album: "Live at Wembley"},
+		{name: "regex not matched", rules: []db.TitleRule{{Action: db.RuleExclude, Field: db.RuleAlbum, Pattern: `^live\b`, Regex: true}}, album: "Alive", want: true},
+		{name: "excluded track", rules: []db.TitleRule{{Action: db.RuleExclude, Field: db.RuleTrack, Pattern: "interlude"}}, album: "Album", tracks: []string{"Intro", "Interlude"}},
+		{name: "included", rules: []db.TitleRule{{Action: db.RuleInclude, Field: db.RuleTrack, Pattern: "remix"}}, album: "Single", tracks: []string{"Song - Remix"}, want: true},
+		{name: "not included", rules: []db.TitleRule{{Action: db.RuleInclude, Field: db.RuleAlbum, Pattern: "remix"}}, album: "Single"},
+		{name: "exclude wins", rules: []db.TitleRule{
+			{Action: db.RuleInclude, Field: db.RuleAlbum, Pattern: "remix"},
+			{Action: db.RuleExclude, Field: db.RuleAlbum, Pattern: "sped up"},
+		}, album: "Remix (Sped Up)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := titleRules(db.Settings{TitleRules: tt.rules})
+			got, reason := titleVerdict(rules, spotify.Album{Name: tt.album}, tt.tracks)
+			if got != tt.want {
+				t.Errorf("titleVerdict() = %v, %q, want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseRules(t *testing.T) {
+	settings := db.Settings{TitleRules: []db.TitleRule{
+		{Action: db.RuleExclude, Field: db.RuleAlbum, Pattern: "karaoke"},
+		{Action: db.RuleInclude, Field: db.RuleTrack, Pattern: "remix|edit", Regex: true},
+	}}
+	rules, err := parseRules(rulesText(settings) + "\n\n  sped up ")
+	if err != nil {
+		t.Fatalf("parseRules() error = %v", err)
+	}
+	want := []db.TitleRule{
+		{Action: db.RuleExclude, Field: db.RuleAlbum, Pattern: "karaoke"},
+		{Action: db.RuleInclude, Field: db.RuleTrack, Pattern: "remix|edit", Regex: true},
+		{Action: db.RuleExclude, Field: db.RuleAlbum, Pattern: "sped up"},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("parseRules() = %+v, want %+v", rules, want)
+	}
+
+	if _, err := parseRules("live\nexclude /(/"); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("parseRules() error = %v, want an error of line 2", err)
+	}
+}
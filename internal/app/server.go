@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
@@ -13,22 +15,35 @@ import (
 	"TeleBotNotifications/internal/config"
 	"TeleBotNotifications/internal/db"
 	"TeleBotNotifications/internal/logger"
+	"TeleBotNotifications/internal/scheduler"
 	"TeleBotNotifications/internal/spotify"
 	"TeleBotNotifications/internal/telegram"
 )
 
 type Server struct {
-	bot                telegram.Bot
-	spotifyClient      *spotify.Client
-	db                 db.DB
-	config             *config.Config
-	cancelSpotifyCheck context.CancelFunc
-	wg                 sync.WaitGroup
+	bot           telegram.Bot
+	spotifyClient *spotify.Client
+	db            db.DB
+	config        *config.Config
+	health        *health
+	scheduler     *scheduler.Scheduler
+	// Schedule of users without their own one
+	defaultSchedule scheduler.Schedule
+	web             *webSessions
+	artists         *artistCache
+	checksMu        sync.Mutex
+	runningChecks   map[string]runningCheck
+	wg              sync.WaitGroup
+}
+
+type runningCheck struct {
+	userId int
+	cancel context.CancelFunc
 }
 
 func New() (*Server, error) {
 	var err error
-	s := &Server{}
+	s := &Server{health: newHealth(), web: newWebSessions(), artists: newArtistCache(), runningChecks: make(map[string]runningCheck)}
 
 	s.config, err = config.NewConfig()
 	if err != nil {
@@ -43,70 +58,123 @@ func New() (*Server, error) {
 
 	s.db = db.NewDB(fmt.Sprintf("%s/save.json", s.config.WorkingDirectory))
 
+	s.defaultSchedule, err = scheduler.Parse(s.config.Scheduler.Default)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing default schedule: %w", err)
+	}
+	s.scheduler = scheduler.New(scheduler.RealClock, time.Duration(s.config.Scheduler.JitterSeconds)*time.Second)
+
 	s.spotifyClient, err = spotify.NewClient(&s.config.Spotify)
 	if err != nil {
 		return nil, err
 	}
 
-	logger.General.Println("Server created")
+	slog.Info("server created")
 	return s, nil
 }
 
 func (s *Server) Run() {
-	logger.General.Println("Starting server")
+	slog.Info("starting server")
 
 	err := s.db.Load()
-	logger.General.Println("DB loaded")
 	if err != nil {
-		logger.Error.Println("DB load error", err)
+		slog.Error("db load failed", "error", err)
 		return
 	}
+	slog.Info("db loaded")
+	s.health.setDBLoaded()
+	s.health.checked(s.lastSuccessfulCheck())
 
 	// For stopping goroutins on exit signal
 	generalContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	reopenLogs := make(chan os.Signal, 1)
+	signal.Notify(reopenLogs, syscall.SIGHUP)
+
+	s.bot.Use(
+		telegram.Recover(slog.Default()),
+		telegram.Logging(slog.Default()),
+		telegram.Metrics(),
+		telegram.Auth(func(r telegram.Request) bool {
+			return r.ChatId == s.config.Telegram.ChatId
+		}),
+		telegram.RateLimit(20, time.Minute),
+	)
 
 	s.bot.AddCommand("auth", "submit an authentication link", s.GetCodeFromUrl)
 	s.bot.AddCommand("start", "Get a link to steal your account", s.Greet)
 	s.bot.AddCommand("check", "Find new releses in the past n days (default 7)", s.ForceCheck)
+	s.bot.AddCommand("dashboard", "Get a link to the settings and release history", s.Dashboard)
+	s.bot.AddCommand("digest", "Get releases in one message: daily, weekly, <cron> or off", s.SetDigest)
+	s.bot.AddCommand("timezone", "Show or set the timezone, e.g. Europe/Berlin or UTC+3", s.Timezone)
+	s.bot.AddCommand("quiet", "Set quiet hours, e.g. 22:00-08:00 hold or silent, or off", s.Quiet)
+	s.bot.AddCommand("settings", "Choose release types and groups", s.Settings)
+	s.bot.AddCommand("artists", "Change levels of followed artists: muted, silent, normal or priority", s.Artists)
+	s.bot.AddCommand("mute", "Mute a followed artist by name", s.Mute)
+	s.bot.AddCommand("rules", "List, add or test include and exclude rules for titles", s.Rules)
+	s.bot.OnLocation(s.ShareLocation)
 
 	s.bot.AddCallback("queue", s.AddToQueue)
 	s.bot.AddCallback("play", s.PlayTrack)
+	s.bot.AddCallback("digest", s.TurnDigestPage)
+	s.bot.AddCallback("artists", s.ArtistsPage)
+	s.bot.AddCallback("level", s.CycleArtistLevel)
+	s.bot.AddCallback("mute", s.ToggleMute)
+	s.bot.AddCallback("set", s.ChangeSetting)
+
+	username, err := s.getMe(generalContext)
+	if err != nil {
+		slog.Error("telegram getMe failed", "error", err)
+	}
+	s.health.setGetMe(username, err)
 
 	err = s.bot.UpdateCommands()
 	if err != nil {
-		logger.Error.Println("can't update telegram commans: ", err)
+		slog.Error("can't update telegram commands", "error", err)
 		return
 	}
 
+	s.bot.StartDispatcher(&s.wg)
+	s.serveHTTP(generalContext)
+
+	for _, user := range s.db.Users() {
+		s.scheduleUser(user.UserId)
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.scheduler.Run(generalContext)
+	}()
+
 	tgUpdateSignal := make(chan struct{}, 1)
 	tgUpdateSignal <- struct{}{}
-	// TODO: make config variable
-	ticker := time.NewTicker(time.Hour)
-	defer ticker.Stop()
 
-	logger.General.Println("Bot started")
+	slog.Info("bot started")
 
 Loop:
 	for {
 		select {
 		case <-sigs:
 			cancel()
-			if s.cancelSpotifyCheck != nil {
-				s.cancelSpotifyCheck()
-			}
+			s.cancelChecks()
+			// Handlers already received are finished before the server stops
+			s.bot.StopDispatcher()
 			break Loop
 		case <-tgUpdateSignal:
 			s.wg.Add(1)
 			go func() {
 				defer s.wg.Done()
 				err := s.bot.HandleUpdates(generalContext)
+				if errors.Is(err, context.Canceled) {
+					return
+				}
+				// The loop is alive during Telegram outages, readiness
+				// tells about failed fetches
+				s.health.polled(err)
 				if err != nil {
-					if errors.Is(err, context.Canceled) {
-						return
-					}
-					logger.Error.Println(err)
+					slog.Error("handling updates failed", "error", err)
 					time.Sleep(1 * time.Second)
 				}
 				select {
@@ -116,11 +184,134 @@ Loop:
 					tgUpdateSignal <- struct{}{}
 				}
 			}()
-		case <-ticker.C:
-			s.CheckNewReleases(nil, false)
+		case <-reopenLogs:
+			if err := logger.Reopen(); err != nil {
+				slog.Error("log file reopen failed", "error", err)
+			}
 		}
 	}
 
 	s.wg.Wait()
-	logger.Error.Println("Bot stopped")
+	slog.Warn("bot stopped")
+	logger.Close()
+	s.bot.StopSender()
+}
+
+// userJob is the scheduler key of the user's checks
+func userJob(userId int) string {
+	return "user:" + strconv.Itoa(userId)
+}
+
+// scheduleUser plans automatic checks of the user according to the user's
+// schedule or the default one, digests and the end of quiet hours. Schedules
+// run in the timezone of the user
+func (s *Server) scheduleUser(userId int) {
+	key := userJob(userId)
+	user := s.db.Get(userId)
+	s.scheduleDigest(userId, user)
+	s.scheduleQuietEnd(userId, user)
+	if user == nil || user.Settings.Schedule == db.ScheduleOff {
+		s.scheduler.Remove(key)
+		return
+	}
+
+	schedule, err := s.userSchedule(user)
+	if err != nil {
+		slog.Warn("wrong user schedule, using the default one", "user_id", userId, "error", err)
+	}
+	s.scheduler.Set(key, schedule, user.Settings.Location(), user.LastCheck, func(time.Time) {
+		_, err := s.CheckNewReleases(CheckRequest{UserId: userId, Trigger: TriggerSchedule})
+		if err != nil && !errors.Is(err, errEmptyPeriod) {
+			slog.Warn("scheduled check not started", "user_id", userId, "error", err)
+		}
+	})
+	if next, ok := s.scheduler.Next(key); ok {
+		slog.Debug("check scheduled", "user_id", userId, "next", next)
+	}
+}
+
+// userSchedule returns the schedule of automatic checks of the user, nil if
+// they are off. The default schedule is returned with the error of a wrong one
+func (s *Server) userSchedule(user *db.User) (scheduler.Schedule, error) {
+	switch user.Settings.Schedule {
+	case db.ScheduleOff:
+		return nil, nil
+	case "":
+		return s.defaultSchedule, nil
+	}
+	schedule, err := scheduler.Parse(user.Settings.Schedule)
+	if err != nil {
+		return s.defaultSchedule, err
+	}
+	return schedule, nil
+}
+
+// lastSuccessfulCheck returns the end time of the latest finished check.
+// Last check times of users are used for history saved by older versions
+func (s *Server) lastSuccessfulCheck() time.Time {
+	for _, check := range s.db.Checks(0, 0) {
+		if check.Status == db.CheckOk {
+			return check.Finished
+		}
+	}
+	var last time.Time
+	for _, user := range s.db.Users() {
+		if user.LastCheck.After(last) {
+			last = user.LastCheck
+		}
+	}
+	return last
+}
+
+func (s *Server) trackCheck(check db.CheckRecord, cancel context.CancelFunc) {
+	s.checksMu.Lock()
+	defer s.checksMu.Unlock()
+	s.runningChecks[check.Id] = runningCheck{userId: check.UserId, cancel: cancel}
+}
+
+func (s *Server) untrackCheck(checkId string) {
+	s.checksMu.Lock()
+	defer s.checksMu.Unlock()
+	delete(s.runningChecks, checkId)
+}
+
+func (s *Server) checkRunning(userId int) bool {
+	s.checksMu.Lock()
+	defer s.checksMu.Unlock()
+	for _, check := range s.runningChecks {
+		if check.userId == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// CancelCheck stops a running check. It returns false if the check is not
+// running
+func (s *Server) CancelCheck(checkId string) bool {
+	s.checksMu.Lock()
+	defer s.checksMu.Unlock()
+	check, ok := s.runningChecks[checkId]
+	if ok {
+		check.cancel()
+	}
+	return ok
+}
+
+func (s *Server) cancelUserChecks(userId int) {
+	s.checksMu.Lock()
+	defer s.checksMu.Unlock()
+	for _, check := range s.runningChecks {
+		if check.userId == userId {
+			check.cancel()
+		}
+	}
+}
+
+func (s *Server) cancelChecks() {
+	s.checksMu.Lock()
+	defer s.checksMu.Unlock()
+	for _, check := range s.runningChecks {
+		check.cancel()
+	}
 }
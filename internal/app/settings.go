@@ -0,0 +1,205 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/spotify"
+	"TeleBotNotifications/internal/telegram"
+	"TeleBotNotifications/internal/telegram/format"
+)
+
+var groupTitles = map[string]string{
+	spotify.GroupAlbum:       "albums",
+	spotify.GroupSingle:      "singles",
+	spotify.GroupCompilation: "compilations",
+	spotify.GroupAppearsOn:   "features",
+}
+
+// toggle adds or removes the value. Empty list stands for defaults, so the
+// result is empty if it has every default value and nothing else
+func toggle(list, defaults []string, value string) ([]string, error) {
+	if len(list) == 0 {
+		list = defaults
+	}
+	var result []string
+	for _, v := range list {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	if len(result) == len(list) {
+		result = append(result, value)
+	}
+	if len(result) == 0 {
+		return nil, telegram.NewUserError("At least one option must stay selected")
+	}
+
+	if len(result) == len(defaults) {
+		for _, v := range defaults {
+			if !contains(result, v) {
+				return result, nil
+			}
+		}
+		return nil, nil
+	}
+	return result, nil
+}
+
+func selectedTitles(selected, defaults []string) string {
+	if len(selected) == 0 {
+		selected = defaults
+	}
+	titles := make([]string, 0, len(selected))
+	for _, value := range selected {
+		titles = append(titles, groupTitles[value])
+	}
+	return strings.Join(titles, ", ")
+}
+
+func toggleButtons(selected, defaults, values []string, action string) []telegram.InlineKeyboardButton {
+	if len(selected) == 0 {
+		selected = defaults
+	}
+	buttons := make([]telegram.InlineKeyboardButton, 0, len(values))
+	for _, value := range values {
+		mark := "☐"
+		if contains(selected, value) {
+			mark = "✅"
+		}
+		buttons = append(buttons, telegram.CallbackButton(mark+" "+groupTitles[value], fmt.Sprintf("/set %s %s", action, value)))
+	}
+	return buttons
+}
+
+// settingsMenu renders release settings of the user with buttons changing them
+func settingsMenu(settings db.Settings) (*format.Builder, *telegram.InlineKeyboardMarkup) {
+	features := "any artist"
+	if settings.MainArtistOnly {
+		features = "only if a followed artist is the main one"
+	}
+	style := settings.Style
+	if style == "" {
+		style = db.StyleFull
+	}
+
+	text := format.New(format.MarkdownV2).
+		Bold("Settings").Line("").
+		Text("1. Requested from Spotify: ").Bold(selectedTitles(settings.IncludeGroups, spotify.DefaultIncludeGroups)).Line("").
+		Text("2. Kept types: ").Bold(selectedTitles(settings.AlbumTypes, spotify.AlbumTypes)).Line("").
+		Text("3. Kept types of priority artists: ").Bold(selectedTitles(settings.PriorityAlbumTypes, spotify.AlbumTypes)).Line("").
+		Text("Releases with several artists: ").Bold(features).Line("").
+		Text("Style: ").Bold(style)
+
+	mainArtist := "Keep any artist"
+	if !settings.MainArtistOnly {
+		mainArtist = "Keep followed main artists"
+	}
+	nextStyle := db.StyleCompact
+	if style == db.StyleCompact {
+		nextStyle = db.StyleFull
+	}
+	keyboard := &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{
+		{telegram.CallbackButton("1. Requested from Spotify", "/set noop")},
+		toggleButtons(settings.IncludeGroups, spotify.DefaultIncludeGroups, spotify.AlbumGroups, "group"),
+		{telegram.CallbackButton("2. Kept types", "/set noop")},
+		toggleButtons(settings.AlbumTypes, spotify.AlbumTypes, spotify.AlbumTypes, "type"),
+		{telegram.CallbackButton("3. Kept types of priority artists", "/set noop")},
+		toggleButtons(settings.PriorityAlbumTypes, spotify.AlbumTypes, spotify.AlbumTypes, "priority"),
+		{
+			telegram.CallbackButton(mainArtist, "/set main"),
+			telegram.CallbackButton("Use "+nextStyle+" style", "/set style "+nextStyle),
+		},
+	}}
+	return text, keyboard
+}
+
+// applySetting changes the settings as a button of the menu says
+func applySetting(settings *db.Settings, action, value string) error {
+	var err error
+	switch action {
+	case "group":
+		if !contains(spotify.AlbumGroups, value) {
+			return telegram.NewUserError("Unknown group %q", value)
+		}
+		settings.IncludeGroups, err = toggle(settings.IncludeGroups, spotify.DefaultIncludeGroups, value)
+	case "type":
+		if !contains(spotify.AlbumTypes, value) {
+			return telegram.NewUserError("Unknown type %q", value)
+		}
+		settings.AlbumTypes, err = toggle(settings.AlbumTypes, spotify.AlbumTypes, value)
+	case "priority":
+		if !contains(spotify.AlbumTypes, value) {
+			return telegram.NewUserError("Unknown type %q", value)
+		}
+		settings.PriorityAlbumTypes, err = toggle(settings.PriorityAlbumTypes, spotify.AlbumTypes, value)
+	case "main":
+		settings.MainArtistOnly = !settings.MainArtistOnly
+	case "style":
+		if !contains([]string{db.StyleFull, db.StyleCompact}, value) {
+			return telegram.NewUserError("Unknown style %q", value)
+		}
+		settings.Style = value
+	default:
+		return telegram.NewUserError("Unknown setting %q", action)
+	}
+	return err
+}
+
+// Settings sends the settings menu
+func (s *Server) Settings(message telegram.ReceivedMessage) error {
+	user := s.db.Get(message.UserId)
+	if user == nil {
+		return errNoUser
+	}
+	text, keyboard := settingsMenu(user.Settings)
+	reply := telegram.FormattedMessage(text)
+	reply.ChatId = message.ChatId
+	reply.ReplyMarkup = keyboard
+	_, err := s.bot.SendMessage(reply)
+	if err != nil {
+		return fmt.Errorf("error sending settings: %w", err)
+	}
+	return nil
+}
+
+// ChangeSetting applies a button of the settings menu and shows the new state
+func (s *Server) ChangeSetting(callback telegram.Callback) (telegram.CallbackAnswer, error) {
+	user := s.db.Get(callback.UserId)
+	if user == nil {
+		return telegram.CallbackAnswer{}, errNoUser
+	}
+	action, value, _ := strings.Cut(callback.Data, " ")
+	if action == "noop" {
+		return telegram.CallbackAnswer{}, nil
+	}
+
+	settings := user.Settings
+	if err := applySetting(&settings, action, value); err != nil {
+		return telegram.CallbackAnswer{}, err
+	}
+	s.updateSettings(user.UserId, func(stored *db.Settings) {
+		stored.IncludeGroups = settings.IncludeGroups
+		stored.AlbumTypes = settings.AlbumTypes
+		stored.PriorityAlbumTypes = settings.PriorityAlbumTypes
+		stored.MainArtistOnly = settings.MainArtistOnly
+		stored.Style = settings.Style
+	})
+	slog.Info("settings changed", "user_id", user.UserId, "setting", action, "value", value)
+
+	text, keyboard := settingsMenu(settings)
+	parseMode := string(text.Mode())
+	_, err := s.bot.EditMessageText(telegram.EditedMessage{
+		ChatId:      callback.ChatId,
+		MessageId:   callback.MessageId,
+		Text:        text.String(),
+		ParseMode:   &parseMode,
+		ReplyMarkup: keyboard,
+	})
+	if err != nil {
+		return telegram.CallbackAnswer{}, fmt.Errorf("error showing settings: %w", err)
+	}
+	return telegram.CallbackAnswer{Text: "Saved"}, nil
+}
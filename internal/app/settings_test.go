@@ -0,0 +1,59 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/spotify"
+)
+
+func Test_toggle(t *testing.T) {
+	defaults := []string{"album", "single"}
+	tests := []struct {
+		name    string
+		list    []string
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "remove from defaults", value: "single", want: []string{"album"}},
+		{name: "add to defaults", value: "appears_on", want: []string{"album", "single", "appears_on"}},
+		{name: "back to defaults", list: []string{"album"}, value: "single", want: nil},
+		{name: "last one", list: []string{"album"}, value: "album", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toggle(tt.list, defaults, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toggle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("toggle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_applySetting(t *testing.T) {
+	settings := db.Settings{}
+	steps := []struct{ action, value string }{
+		{"group", spotify.GroupAppearsOn},
+		{"type", spotify.GroupSingle},
+		{"main", ""},
+		{"style", db.StyleCompact},
+	}
+	for _, step := range steps {
+		if err := applySetting(&settings, step.action, step.value); err != nil {
+			t.Fatalf("applySetting(%s, %s) error = %v", step.action, step.value, err)
+		}
+	}
+	if fmt.Sprint(settings.IncludeGroups) != "[album single appears_on]" ||
+		fmt.Sprint(settings.AlbumTypes) != "[album compilation]" ||
+		!settings.MainArtistOnly || settings.Style != db.StyleCompact {
+		t.Errorf("settings = %+v", settings)
+	}
+	if err := applySetting(&settings, "group", "podcast"); err == nil {
+		t.Errorf("applySetting() accepted an unknown group")
+	}
+}
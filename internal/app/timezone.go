@@ -0,0 +1,216 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/scheduler"
+	"TeleBotNotifications/internal/telegram"
+	"TeleBotNotifications/internal/telegram/format"
+)
+
+// quietMode returns what happens to notifications sent at the time, empty
+// outside of quiet hours
+func quietMode(settings db.Settings, t time.Time) string {
+	if !settings.QuietHours.Active(t.In(settings.Location())) {
+		return ""
+	}
+	return settings.QuietHours.Mode
+}
+
+func quietJob(userId int) string {
+	return "quiet:" + strconv.Itoa(userId)
+}
+
+// scheduleQuietEnd plans delivery of releases held during quiet hours at the
+// end of the period
+func (s *Server) scheduleQuietEnd(userId int, user *db.User) {
+	key := quietJob(userId)
+	if user == nil || !user.Settings.QuietHours.Enabled() || user.Settings.QuietHours.Mode != db.QuietHold {
+		s.scheduler.Remove(key)
+		return
+	}
+	end, _ := db.ParseClock(user.Settings.QuietHours.End)
+	schedule, err := scheduler.Parse(fmt.Sprintf("%d %d * * *", end%60, end/60))
+	if err != nil {
+		slog.Error("wrong quiet hours", "user_id", userId, "error", err)
+		return
+	}
+	s.scheduler.Set(key, schedule, user.Settings.Location(), user.LastDigest, func(time.Time) {
+		current := s.db.Get(userId)
+		if current == nil || len(current.PendingDigest) == 0 {
+			return
+		}
+		// Releases held for a digest wait for it, unless the digest was due
+		// during quiet hours
+		if current.Settings.Digest != "" && !digestOverdue(current, time.Now()) {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := s.SendDigest(userId); err != nil {
+				slog.Error("releases held during quiet hours not sent", "user_id", userId, "error", err)
+			}
+		}()
+	})
+}
+
+// digestOverdue tells if a digest of the user was planned after the last sent
+// one and before now
+func digestOverdue(user *db.User, now time.Time) bool {
+	schedule, err := scheduler.Parse(user.Settings.Digest)
+	if err != nil {
+		return true
+	}
+	next := schedule.Next(user.LastDigest.In(user.Settings.Location()))
+	return !next.IsZero() && !next.After(now)
+}
+
+// timezoneFromLocation estimates the offset from the longitude. Exact zones
+// with daylight saving time are set by name
+func timezoneFromLocation(location telegram.Location) *time.Location {
+	hours := math.Round(location.Longitude / 15)
+	return db.FixedTimezone(int(hours) * 60 * 60)
+}
+
+func (s *Server) setTimezone(message telegram.ReceivedMessage, location *time.Location) error {
+	s.updateSettings(message.UserId, func(settings *db.Settings) {
+		settings.Timezone = location.String()
+	})
+	s.scheduleUser(message.UserId)
+	slog.Info("timezone changed", "user_id", message.UserId, "timezone", location.String())
+
+	now := time.Now().In(location)
+	reply := telegram.FormattedMessage(format.New(format.MarkdownV2).
+		Text("Timezone set to ").Code(location.String()).
+		Text(". Local time is ").Bold(now.Format("15:04")))
+	reply.ChatId = message.ChatId
+	_, err := s.bot.SendMessage(reply)
+	if err != nil {
+		return fmt.Errorf("error sending timezone: %w", err)
+	}
+	return nil
+}
+
+// Timezone shows or changes the timezone of the user
+func (s *Server) Timezone(message telegram.ReceivedMessage) error {
+	user := s.db.Get(message.UserId)
+	if user == nil {
+		return errNoUser
+	}
+	if message.Text != "" {
+		location, err := db.ParseTimezone(message.Text)
+		if err != nil {
+			return telegram.NewUserError("%s. Use a name like Europe/Berlin or an offset like UTC+3", err)
+		}
+		return s.setTimezone(message, location)
+	}
+
+	location := user.Settings.Location()
+	reply := telegram.FormattedMessage(format.New(format.MarkdownV2).
+		Text("Timezone: ").Code(location.String()).
+		Text(", local time is ").Bold(time.Now().In(location).Format("15:04")).
+		Text(". Change it with ").Code("/timezone Europe/Berlin").
+		Text(" or share your location"))
+	reply.ChatId = message.ChatId
+	_, err := s.bot.SendMessage(reply)
+	if err != nil {
+		return fmt.Errorf("error sending timezone: %w", err)
+	}
+	return nil
+}
+
+// ShareLocation sets the timezone of the user from a shared location
+func (s *Server) ShareLocation(message telegram.ReceivedMessage) error {
+	if s.db.Get(message.UserId) == nil {
+		return errNoUser
+	}
+	return s.setTimezone(message, timezoneFromLocation(*message.Location))
+}
+
+// parseQuietHours reads quiet hours like "22:00-08:00 hold". The mode is
+// hold if omitted, "off" disables quiet hours
+func parseQuietHours(text string) (db.QuietHours, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 1 && fields[0] == "off" {
+		return db.QuietHours{}, nil
+	}
+	if len(fields) < 1 || len(fields) > 2 {
+		return db.QuietHours{}, fmt.Errorf("expected HH:MM-HH:MM and an optional mode")
+	}
+	start, end, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return db.QuietHours{}, fmt.Errorf("expected HH:MM-HH:MM, got %q", fields[0])
+	}
+	quiet := db.QuietHours{Start: start, End: end, Mode: db.QuietHold}
+	if len(fields) == 2 {
+		quiet.Mode = fields[1]
+	}
+	return quiet, validateQuietHours(quiet)
+}
+
+func validateQuietHours(quiet db.QuietHours) error {
+	if quiet.Start == "" && quiet.End == "" {
+		return nil
+	}
+	for _, clock := range []string{quiet.Start, quiet.End} {
+		if _, err := db.ParseClock(clock); err != nil {
+			return err
+		}
+	}
+	if !contains([]string{db.QuietHold, db.QuietSilent}, quiet.Mode) {
+		return fmt.Errorf("unknown mode %q, expected %s or %s", quiet.Mode, db.QuietHold, db.QuietSilent)
+	}
+	return nil
+}
+
+// Quiet shows or changes quiet hours of the user
+func (s *Server) Quiet(message telegram.ReceivedMessage) error {
+	user := s.db.Get(message.UserId)
+	if user == nil {
+		return errNoUser
+	}
+
+	quiet := user.Settings.QuietHours
+	if message.Text != "" {
+		var err error
+		quiet, err = parseQuietHours(message.Text)
+		if err != nil {
+			return telegram.NewUserError("Wrong quiet hours: %s", err)
+		}
+		s.updateSettings(user.UserId, func(settings *db.Settings) {
+			settings.QuietHours = quiet
+		})
+		s.scheduleUser(user.UserId)
+		slog.Info("quiet hours changed", "user_id", user.UserId, "start", quiet.Start, "end", quiet.End, "mode", quiet.Mode)
+	}
+
+	text := format.New(format.MarkdownV2)
+	if !quiet.Enabled() {
+		text.Text("No quiet hours. Set them with ").Code("/quiet 22:00-08:00 hold").
+			Text(" to send releases after the period, or ").Code("/quiet 22:00-08:00 silent").
+			Text(" to send them without sound")
+	} else {
+		text.Text("Quiet hours: ").Bold(quiet.Start + "–" + quiet.End).
+			Text(" " + user.Settings.Location().String() + ". ")
+		if quiet.Mode == db.QuietHold {
+			text.Text("Releases are sent after the period")
+		} else {
+			text.Text("Releases are sent without sound")
+		}
+		text.Text(". Use ").Code("/quiet off").Text(" to disable them")
+	}
+	reply := telegram.FormattedMessage(text)
+	reply.ChatId = message.ChatId
+	_, err := s.bot.SendMessage(reply)
+	if err != nil {
+		return fmt.Errorf("error sending quiet hours: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/telegram"
+)
+
+func Test_stripTime(t *testing.T) {
+	// 23:30 UTC is the next day in Tokyo and the same day in New York
+	instant := time.Date(2024, 3, 8, 23, 30, 0, 0, time.UTC)
+	tokyo, _ := db.ParseTimezone("Asia/Tokyo")
+	newYork, _ := db.ParseTimezone("America/New_York")
+
+	tests := []struct {
+		name     string
+		location *time.Location
+		want     time.Time
+	}{
+		{name: "utc", location: time.UTC, want: time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)},
+		{name: "east", location: tokyo, want: time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)},
+		{name: "west", location: newYork, want: time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripTime(instant, tt.location); !got.Equal(tt.want) {
+				t.Errorf("stripTime() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseQuietHours(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    db.QuietHours
+		wantErr bool
+	}{
+		{name: "default mode", text: "22:00-08:00", want: db.QuietHours{Start: "22:00", End: "08:00", Mode: db.QuietHold}},
+		{name: "silent", text: "23:30-07:00 silent", want: db.QuietHours{Start: "23:30", End: "07:00", Mode: db.QuietSilent}},
+		{name: "off", text: "off", want: db.QuietHours{}},
+		{name: "wrong time", text: "25:00-08:00", wantErr: true},
+		{name: "wrong mode", text: "22:00-08:00 loud", wantErr: true},
+		{name: "no range", text: "22:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseQuietHours(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseQuietHours(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseQuietHours(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_quietMode(t *testing.T) {
+	settings := db.Settings{
+		Timezone:   "UTC+3",
+		QuietHours: db.QuietHours{Start: "22:00", End: "08:00", Mode: db.QuietSilent},
+	}
+	// 20:00 UTC is 23:00 in the zone of the user
+	if mode := quietMode(settings, time.Date(2024, 3, 8, 20, 0, 0, 0, time.UTC)); mode != db.QuietSilent {
+		t.Errorf("quietMode() = %q, want %q", mode, db.QuietSilent)
+	}
+	if mode := quietMode(settings, time.Date(2024, 3, 8, 12, 0, 0, 0, time.UTC)); mode != "" {
+		t.Errorf("quietMode() = %q outside of quiet hours", mode)
+	}
+}
+
+func Test_digestOverdue(t *testing.T) {
+	user := &db.User{
+		LastDigest: time.Date(2024, 3, 8, 9, 0, 0, 0, time.UTC),
+		Settings:   db.Settings{Digest: digestPresets["daily"]},
+	}
+	if digestOverdue(user, time.Date(2024, 3, 9, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("digest is overdue before the next one is planned")
+	}
+	if !digestOverdue(user, time.Date(2024, 3, 9, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("skipped digest is not overdue")
+	}
+}
+
+func Test_timezoneFromLocation(t *testing.T) {
+	location := timezoneFromLocation(telegram.Location{Latitude: 55.75, Longitude: 37.62})
+	if location.String() != "UTC+03:00" {
+		t.Errorf("timezoneFromLocation() = %s, want UTC+03:00", location)
+	}
+}
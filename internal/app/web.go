@@ -0,0 +1,471 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/scheduler"
+	"TeleBotNotifications/internal/telegram"
+	"TeleBotNotifications/internal/telegram/format"
+)
+
+const loginLinkTTL = 15 * time.Minute
+const sessionTTL = 7 * 24 * time.Hour
+const sessionCookie = "session"
+
+// Number of notified releases shown in the dashboard
+const dashboardReleases = 100
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var dashboardTemplate = template.Must(template.ParseFS(templateFS, "templates/dashboard.html"))
+
+type webLogin struct {
+	userId  int
+	expires time.Time
+}
+
+type webSession struct {
+	userId  int
+	csrf    string
+	expires time.Time
+}
+
+// webSessions keeps one time login tokens sent in Telegram and browser
+// sessions created from them. They are kept in memory, after a restart the
+// user asks for a new link
+type webSessions struct {
+	mu       sync.Mutex
+	logins   map[string]webLogin
+	sessions map[string]webSession
+	now      func() time.Time
+}
+
+func newWebSessions() *webSessions {
+	return &webSessions{
+		logins:   make(map[string]webLogin),
+		sessions: make(map[string]webSession),
+		now:      time.Now,
+	}
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (w *webSessions) newLogin(userId int) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	for key, login := range w.logins {
+		if now.After(login.expires) {
+			delete(w.logins, key)
+		}
+	}
+	for key, session := range w.sessions {
+		if now.After(session.expires) {
+			delete(w.sessions, key)
+		}
+	}
+	w.logins[token] = webLogin{userId: userId, expires: now.Add(loginLinkTTL)}
+	return token, nil
+}
+
+// login exchanges a login token for a new session. A token works only once
+func (w *webSessions) login(token string) (string, webSession, error) {
+	w.mu.Lock()
+	login, ok := w.logins[token]
+	delete(w.logins, token)
+	w.mu.Unlock()
+	if !ok || w.now().After(login.expires) {
+		return "", webSession{}, fmt.Errorf("login link is expired or already used")
+	}
+
+	id, err := randomToken()
+	if err != nil {
+		return "", webSession{}, err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return "", webSession{}, err
+	}
+	session := webSession{userId: login.userId, csrf: csrf, expires: w.now().Add(sessionTTL)}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sessions[id] = session
+	return id, session, nil
+}
+
+func (w *webSessions) get(id string) (webSession, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	session, ok := w.sessions[id]
+	if !ok || w.now().After(session.expires) {
+		return webSession{}, false
+	}
+	return session, true
+}
+
+func (w *webSessions) logout(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.sessions, id)
+}
+
+func (s *Server) webURL(path string) string {
+	return strings.TrimRight(s.config.Web.BaseUrl, "/") + path
+}
+
+// Dashboard sends a login link to the web dashboard
+func (s *Server) Dashboard(message telegram.ReceivedMessage) error {
+	if s.db.Get(message.UserId) == nil {
+		return errNoUser
+	}
+	token, err := s.web.newLogin(message.UserId)
+	if err != nil {
+		return err
+	}
+
+	text := format.New(format.HTML).
+		Link("Open dashboard", s.webURL("/login?token="+token)).
+		Line("").
+		Italic(fmt.Sprintf("The link works once within %s", loginLinkTTL))
+	reply := telegram.FormattedMessage(text)
+	reply.ChatId = message.ChatId
+	_, err = s.bot.SendMessage(reply)
+	if err != nil {
+		return fmt.Errorf("error sending dashboard link: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) handleWeb(mux *http.ServeMux) {
+	mux.HandleFunc("/login", s.webLogin)
+	mux.HandleFunc("/logout", s.webSession(s.webLogout))
+	mux.HandleFunc("/dashboard", s.webSession(s.webDashboard))
+	mux.HandleFunc("/dashboard/settings", s.webSession(s.webSaveSettings))
+	mux.HandleFunc("/dashboard/artists", s.webSession(s.webSetArtistLevel))
+	mux.HandleFunc("/dashboard/feed", s.webSession(s.webRegenerateFeed))
+	mux.HandleFunc("/feeds/", s.handleFeeds)
+}
+
+func (s *Server) webLogin(w http.ResponseWriter, r *http.Request) {
+	id, session, err := s.web.login(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, "Login link is expired or already used. Send /dashboard to the bot for a new one", http.StatusUnauthorized)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		Expires:  session.expires,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.config.Web.BaseUrl, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	slog.Info("dashboard login", "user_id", session.userId)
+	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+}
+
+type webHandler func(w http.ResponseWriter, r *http.Request, user *db.User, session webSession)
+
+// webSession passes the user of the session to the handler. Forms must carry
+// the CSRF token of the session
+func (s *Server) webSession(handler webHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(sessionCookie)
+		if err != nil {
+			http.Error(w, "Not logged in. Send /dashboard to the bot for a login link", http.StatusUnauthorized)
+			return
+		}
+		session, ok := s.web.get(cookie.Value)
+		if !ok {
+			http.Error(w, "Session expired. Send /dashboard to the bot for a new login link", http.StatusUnauthorized)
+			return
+		}
+		user := s.db.Get(session.userId)
+		if user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			if subtle.ConstantTimeCompare([]byte(r.PostFormValue("csrf")), []byte(session.csrf)) != 1 {
+				http.Error(w, "Invalid form token", http.StatusForbidden)
+				return
+			}
+		} else if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r, user, session)
+	}
+}
+
+func (s *Server) webLogout(w http.ResponseWriter, r *http.Request, _ *db.User, _ webSession) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		s.web.logout(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	fmt.Fprintln(w, "Logged out")
+}
+
+type option struct {
+	Value    string
+	Label    string
+	Selected bool
+}
+
+func options(selected string, values ...string) []option {
+	result := make([]option, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		result = append(result, option{Value: values[i], Label: values[i+1], Selected: values[i] == selected})
+	}
+	return result
+}
+
+type scopeStatus struct {
+	Name    string
+	Granted bool
+}
+
+type webArtist struct {
+	Id    string
+	Name  string
+	Level string
+}
+
+type webRelease struct {
+	db.Notification
+	Artists []webArtist
+}
+
+type dashboardPage struct {
+	User         *db.User
+	CSRF         string
+	Saved        bool
+	Scopes       []scopeStatus
+	TokenExpired bool
+	Refreshable  bool
+	Styles       []option
+	Schedule     string
+	Schedules    []option
+	Default      string
+	NextCheck    time.Time
+	Digest       string
+	Digests      []option
+	NextDigest   time.Time
+	Held         int
+	Levels       []string
+	Timezone     string
+	QuietHours   db.QuietHours
+	QuietModes   []option
+	Rules        string
+	Artists      []webArtist
+	Releases     []webRelease
+	Feeds        []feedLink
+}
+
+type feedLink struct {
+	Name string
+	Url  string
+}
+
+func (s *Server) webDashboard(w http.ResponseWriter, r *http.Request, user *db.User, session webSession) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	settings := user.Settings
+	style := settings.Style
+	if style == "" {
+		style = db.StyleFull
+	}
+	page := dashboardPage{
+		User:         user,
+		CSRF:         session.csrf,
+		Saved:        r.URL.Query().Has("saved"),
+		TokenExpired: user.Token.Expired(),
+		Refreshable:  user.Token.RefreshToken != "",
+		Styles:       options(style, db.StyleFull, "Cover preview with buttons", db.StyleCompact, "Compact link"),
+		Schedule:     settings.Schedule,
+		Schedules:    options(settings.Schedule, db.ScheduleDaily, "Every day", db.ScheduleWeekly, "Every week", db.ScheduleOff, "Only on /check"),
+		Default:      s.config.Scheduler.Default,
+		Digest:       settings.Digest,
+		Digests:      options(settings.Digest, digestPresets["daily"], "Every day at 9:00", digestPresets["weekly"], "Fridays at 18:00"),
+		Held:         len(user.PendingDigest),
+		Levels:       db.Levels,
+		Timezone:     settings.Location().String(),
+		QuietHours:   settings.QuietHours,
+		QuietModes:   options(settings.QuietHours.Mode, db.QuietHold, "Send releases after quiet hours", db.QuietSilent, "Send releases without sound"),
+		Rules:        rulesText(settings),
+	}
+	page.NextCheck, _ = s.scheduler.Next(userJob(user.UserId))
+	page.NextDigest, _ = s.scheduler.Next(digestJob(user.UserId))
+	if user.FeedToken != "" {
+		page.Feeds = []feedLink{
+			{Name: "Atom", Url: s.webURL("/feeds/" + user.FeedToken + "/atom.xml")},
+			{Name: "RSS", Url: s.webURL("/feeds/" + user.FeedToken + "/rss.xml")},
+			{Name: "Calendar", Url: s.webURL("/feeds/" + user.FeedToken + "/releases.ics")},
+		}
+	}
+
+	granted := strings.Fields(user.Token.Scope)
+	for _, scope := range strings.Fields(s.config.Spotify.Scope) {
+		page.Scopes = append(page.Scopes, scopeStatus{Name: scope, Granted: contains(granted, scope)})
+	}
+
+	for id, artist := range settings.Artists {
+		page.Artists = append(page.Artists, webArtist{Id: id, Name: artist.Name, Level: artist.Level})
+	}
+	sort.Slice(page.Artists, func(i, j int) bool { return page.Artists[i].Name < page.Artists[j].Name })
+
+	for _, notification := range s.db.Notifications(user.UserId, dashboardReleases) {
+		if notification.Error != "" {
+			continue
+		}
+		release := webRelease{Notification: notification}
+		for _, artist := range notification.Album.Artists {
+			release.Artists = append(release.Artists, webArtist{Id: artist.Id, Name: artist.Name, Level: settings.ArtistLevel(artist.Id)})
+		}
+		page.Releases = append(page.Releases, release)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, page); err != nil {
+		slog.Error("dashboard rendering failed", "error", err)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// updateSettings changes the settings of the user and saves the DB
+func (s *Server) updateSettings(userId int, update func(settings *db.Settings)) {
+	s.db.Update(userId, func(user *db.User) {
+		update(&user.Settings)
+	})
+	if err := s.db.Save(); err != nil {
+		slog.Error("db save failed", "error", err)
+	}
+}
+
+func (s *Server) webSaveSettings(w http.ResponseWriter, r *http.Request, user *db.User, _ webSession) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	style := r.PostFormValue("style")
+	if !contains([]string{db.StyleFull, db.StyleCompact}, style) {
+		http.Error(w, "Unknown style", http.StatusBadRequest)
+		return
+	}
+	// Empty schedule means the default one
+	schedule := strings.TrimSpace(r.PostFormValue("schedule"))
+	if schedule != "" && schedule != db.ScheduleOff {
+		if _, err := scheduler.Parse(schedule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	digest, err := parseDigest(r.PostFormValue("digest"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	location, err := db.ParseTimezone(r.PostFormValue("timezone"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	quiet := db.QuietHours{
+		Start: strings.TrimSpace(r.PostFormValue("quiet_start")),
+		End:   strings.TrimSpace(r.PostFormValue("quiet_end")),
+		Mode:  r.PostFormValue("quiet_mode"),
+	}
+	if quiet.Start == "" && quiet.End == "" {
+		quiet = db.QuietHours{}
+	}
+	if err := validateQuietHours(quiet); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rules, err := parseRules(r.PostFormValue("rules"))
+	if err != nil {
+		http.Error(w, "Wrong title rule, "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.updateSettings(user.UserId, func(settings *db.Settings) {
+		settings.Style = style
+		settings.Schedule = schedule
+		settings.TitleRules = rules
+		settings.Digest = digest
+		settings.Timezone = location.String()
+		settings.QuietHours = quiet
+	})
+	s.scheduleUser(user.UserId)
+	if digest == "" && len(user.PendingDigest) > 0 {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := s.SendDigest(user.UserId); err != nil {
+				slog.Error("digest not sent", "user_id", user.UserId, "error", err)
+			}
+		}()
+	}
+	slog.Info("settings changed", "user_id", user.UserId, "style", style, "schedule", schedule, "digest", digest, "title_rules", len(rules))
+	http.Redirect(w, r, "/dashboard?saved", http.StatusSeeOther)
+}
+
+func (s *Server) webSetArtistLevel(w http.ResponseWriter, r *http.Request, user *db.User, _ webSession) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	artistId := r.PostFormValue("artist_id")
+	level := r.PostFormValue("level")
+	if artistId == "" || !contains(db.Levels, level) {
+		http.Error(w, "Unknown artist or level", http.StatusBadRequest)
+		return
+	}
+
+	s.updateSettings(user.UserId, func(settings *db.Settings) {
+		settings.SetArtistLevel(artistId, r.PostFormValue("name"), level)
+	})
+	slog.Info("artist level changed", "user_id", user.UserId, "artist_id", artistId, "level", level)
+	http.Redirect(w, r, "/dashboard?saved", http.StatusSeeOther)
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"TeleBotNotifications/internal/db"
+	"TeleBotNotifications/internal/spotify"
+)
+
+// loginCookie logs in with a fresh login link and returns the session cookie
+// and the CSRF token
+func loginCookie(t *testing.T, s *Server, mux *http.ServeMux, userId int) (*http.Cookie, string) {
+	token, err := s.web.newLogin(userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/login?token="+token, nil))
+	if recorder.Code != http.StatusSeeOther {
+		t.Fatalf("login status = %d, want %d", recorder.Code, http.StatusSeeOther)
+	}
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("login cookies = %v", cookies)
+	}
+	session, _ := s.web.get(cookies[0].Value)
+
+	// Login links work once
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/login?token="+token, nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("second login status = %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+	return cookies[0], session.csrf
+}
+
+func Test_webDashboard(t *testing.T) {
+	s := newTestServer(t)
+	s.db.AddNotification(db.Notification{UserId: 1, Album: spotify.Album{
+		Name:     "Album <1>",
+		ImageUrl: "https://i.scdn.co/image/cover",
+		Artists:  []spotify.Artist{{Id: "artist", Name: "Artist"}},
+	}})
+	mux := http.NewServeMux()
+	s.handleWeb(mux)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("dashboard without session status = %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+
+	cookie, csrf := loginCookie(t, s, mux, 1)
+	request := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	request.AddCookie(cookie)
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+	body := recorder.Body.String()
+	for _, want := range []string{"Album &lt;1&gt;", "https://i.scdn.co/image/cover", csrf} {
+		if !strings.Contains(body, want) {
+			t.Errorf("dashboard doesn't contain %q", want)
+		}
+	}
+
+	post := func(path string, form url.Values) int {
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.AddCookie(cookie)
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	form := url.Values{"style": {db.StyleCompact}, "schedule": {db.ScheduleWeekly}, "rules": {" remix \n\nexclude track /live$/"}}
+	if code := post("/dashboard/settings", form); code != http.StatusForbidden {
+		t.Errorf("settings without CSRF token status = %d, want %d", code, http.StatusForbidden)
+	}
+	form.Set("csrf", csrf)
+	form.Set("rules", "exclude /(live/")
+	if code := post("/dashboard/settings", form); code != http.StatusBadRequest {
+		t.Errorf("settings with a wrong rule status = %d, want %d", code, http.StatusBadRequest)
+	}
+	form.Set("rules", " remix \n\nexclude track /live$/")
+	if code := post("/dashboard/settings", form); code != http.StatusSeeOther {
+		t.Errorf("settings status = %d, want %d", code, http.StatusSeeOther)
+	}
+	form = url.Values{"csrf": {csrf}, "artist_id": {"artist"}, "name": {"Artist"}, "level": {db.LevelMuted}}
+	if code := post("/dashboard/artists", form); code != http.StatusSeeOther {
+		t.Errorf("artists status = %d, want %d", code, http.StatusSeeOther)
+	}
+
+	settings := s.db.Get(1).Settings
+	if settings.Style != db.StyleCompact || settings.Schedule != db.ScheduleWeekly {
+		t.Errorf("settings = %+v", settings)
+	}
+	wantRules := []db.TitleRule{
+		{Action: db.RuleExclude, Field: db.RuleAlbum, Pattern: "remix"},
+		{Action: db.RuleExclude, Field: db.RuleTrack, Pattern: "live$", Regex: true},
+	}
+	if !reflect.DeepEqual(settings.TitleRules, wantRules) {
+		t.Errorf("title rules = %+v, want %+v", settings.TitleRules, wantRules)
+	}
+	if settings.ArtistLevel("artist") != db.LevelMuted {
+		t.Errorf("artist level = %s, want %s", settings.ArtistLevel("artist"), db.LevelMuted)
+	}
+	if s.db.Get(2).Settings.Style != "" {
+		t.Errorf("settings of another user changed")
+	}
+}
+
+func Test_webSessionsExpire(t *testing.T) {
+	now := time.Now()
+	sessions := newWebSessions()
+	sessions.now = func() time.Time { return now }
+
+	token, err := sessions.newLogin(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(loginLinkTTL + time.Second)
+	if _, _, err := sessions.login(token); err == nil {
+		t.Errorf("login() with expired link succeeded")
+	}
+
+	token, _ = sessions.newLogin(1)
+	id, _, err := sessions.login(token)
+	if err != nil {
+		t.Fatalf("login() error = %v", err)
+	}
+	now = now.Add(sessionTTL + time.Second)
+	if _, ok := sessions.get(id); ok {
+		t.Errorf("get() returned expired session")
+	}
+}
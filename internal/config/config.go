@@ -18,24 +18,65 @@ type SpotifyConfig struct {
 }
 
 type TelegramConfig struct {
-	BotToken string `env:"TELEGRAM_BOT_TOKEN"`
-	ChatId   int    `env:"TELEGRAM_CHAT_ID"`
-	Timeout  int    `json:"timeout"`
+	BotToken     string `env:"TELEGRAM_BOT_TOKEN"`
+	ChatId       int    `env:"TELEGRAM_CHAT_ID"`
+	Timeout      int    `json:"timeout"`
+	Workers      int    `json:"workers"`
+	SendAttempts int    `json:"send_attempts"`
+}
+
+// SinkConfig sets the minimal level (debug, info, warn, error or off) and the
+// format (text or json) of a log output
+type SinkConfig struct {
+	Level  string `json:"level"`
+	Format string `json:"format"`
+}
+
+// RotationConfig limits log files. Zero values disable the limit
+type RotationConfig struct {
+	MaxSizeMB   uint `json:"max_size_mb"`
+	MaxAgeHours uint `json:"max_age_hours"`
+	MaxFiles    uint `json:"max_files"`
+	Compress    bool `json:"compress"`
 }
 
 type LoggerConfig struct {
-	Path             string
-	TelegramLogLevel uint `json:"telegram_log_level"`
-	FileLogLevel     uint `json:"file_log_level"`
-	StdLogLevel      uint `json:"std_log_level"`
+	Path                 string
+	Std                  SinkConfig     `json:"std"`
+	File                 SinkConfig     `json:"file"`
+	Telegram             SinkConfig     `json:"telegram"`
+	TelegramFlushSeconds uint           `json:"telegram_flush_seconds"`
+	TelegramDedupMinutes uint           `json:"telegram_dedup_minutes"`
+	Rotation             RotationConfig `json:"rotation"`
+}
+
+// SchedulerConfig sets the schedule of automatic checks for users without
+// their own one, as a cron expression, a descriptor like @daily or an interval.
+// Checks of users are spread over the jitter
+type SchedulerConfig struct {
+	Default       string `json:"default"`
+	JitterSeconds uint   `json:"jitter_seconds"`
+}
+
+// WebConfig sets the address of the dashboard used in login links
+type WebConfig struct {
+	BaseUrl string `json:"base_url"`
+}
+
+// AdminConfig enables the admin API. It is disabled while the token is empty
+type AdminConfig struct {
+	Token string `env:"ADMIN_TOKEN,optional"`
 }
 
 type Config struct {
-	WorkingDirectory string         `env:"WORKING_DIRECTORY"`
-	Port             uint           `json:"port"`
-	Spotify          SpotifyConfig  `json:"spotify"`
-	Telegram         TelegramConfig `json:"telegram"`
-	Logger           LoggerConfig   `json:"logger"`
+	WorkingDirectory string          `env:"WORKING_DIRECTORY"`
+	Port             uint            `json:"port"`
+	Spotify          SpotifyConfig   `json:"spotify"`
+	Telegram         TelegramConfig  `json:"telegram"`
+	Logger           LoggerConfig    `json:"logger"`
+	Scheduler        SchedulerConfig `json:"scheduler"`
+	Web              WebConfig       `json:"web"`
+	Admin            AdminConfig
 }
 
 func (c *Config) readJson() error {
@@ -70,5 +111,10 @@ func NewConfig() (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error loading config: %v", err)
 	}
+	// Configs written before the scheduler ticked hourly, but a check ran only
+	// once the date changed, so checks were daily after midnight
+	if config.Scheduler.Default == "" {
+		config.Scheduler.Default = "@daily"
+	}
 	return config, nil
 }
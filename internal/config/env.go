@@ -5,13 +5,14 @@ import (
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 )
 
 func LoadConfigFromEnv(cfg interface{}) error {
     v := reflect.ValueOf(cfg).Elem()
     for i := 0; i < v.NumField(); i++ {
         field := v.Field(i)
-        tag := v.Type().Field(i).Tag.Get("env")
+        tag, option, _ := strings.Cut(v.Type().Field(i).Tag.Get("env"), ",")
 
         // If the field is another struct, recurse
         if field.Kind() == reflect.Struct {
@@ -29,6 +30,10 @@ func LoadConfigFromEnv(cfg interface{}) error {
 
         envValue := os.Getenv(tag)
         if envValue == "" {
+			// Fields tagged `env:"NAME,optional"` keep their zero value
+			if option == "optional" {
+				continue
+			}
 			return fmt.Errorf("missing env variable: %s", tag)
         }
 
@@ -4,29 +4,223 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
-	"TeleBotNotifications/internal/logger"
 	"TeleBotNotifications/internal/spotify"
 )
 
+// Only the latest entries of the history are kept
+const maxChecks = 200
+const maxNotifications = 1000
+const maxDigests = 50
+
 type User struct {
 	UserId    int                 `json:"user_id"`
 	ChatId    int                 `json:"chat_id"`
 	Token     spotify.OAuth2Token `json:"token"`
 	LastCheck time.Time           `json:"last_check"`
+	Settings  Settings            `json:"settings"`
+	// Secret part of feed URLs, feeds are disabled while it is empty
+	FeedToken string `json:"feed_token,omitempty"`
+	// Releases waiting for the next digest
+	PendingDigest []DigestRelease `json:"pending_digest,omitempty"`
+	LastDigest    time.Time       `json:"last_digest"`
+}
+
+// DigestRelease is a release found by a check and held for a digest
+type DigestRelease struct {
+	CheckId string        `json:"check_id"`
+	Found   time.Time     `json:"found"`
+	Album   spotify.Album `json:"album"`
+}
+
+// Notification styles
+const (
+	StyleFull    = "full"
+	StyleCompact = "compact"
+)
+
+// Schedules of automatic checks
+const (
+	ScheduleDaily  = "@daily"
+	ScheduleWeekly = "@weekly"
+	ScheduleOff    = "off"
+)
+
+// Artist levels
+const (
+	// Releases of muted artists are skipped
+	LevelMuted = "muted"
+	// Releases of silent artists are sent without sound
+	LevelSilent = "silent"
+	LevelNormal = "normal"
+	// Releases of priority artists skip the digest
+	LevelPriority = "priority"
+)
+
+// Title rule actions and fields
+const (
+	RuleInclude = "include"
+	RuleExclude = "exclude"
+	RuleAlbum   = "album"
+	RuleTrack   = "track"
+)
+
+// TitleRule matches album or track titles by a case-insensitive substring or
+// regular expression
+type TitleRule struct {
+	Action  string `json:"action"`
+	Field   string `json:"field"`
+	Pattern string `json:"pattern"`
+	Regex   bool   `json:"regex,omitempty"`
+}
+
+// Levels lists artist levels from the lowest
+var Levels = []string{LevelMuted, LevelSilent, LevelNormal, LevelPriority}
+
+type ArtistSettings struct {
+	Name  string `json:"name"`
+	Level string `json:"level"`
+}
+
+// Settings are chosen by the user, zero values mean the defaults
+type Settings struct {
+	Style    string                    `json:"style,omitempty"`
+	Schedule string                    `json:"schedule,omitempty"`
+	Artists  map[string]ArtistSettings `json:"artists,omitempty"`
+	// Read from save files of older versions only, Load moves the keywords
+	// into title rules
+	ExcludeKeywords []string    `json:"exclude_keywords,omitempty"`
+	TitleRules      []TitleRule `json:"title_rules,omitempty"`
+	// Schedule of digests, releases are sent instantly while it is empty
+	Digest string `json:"digest,omitempty"`
+	// Album groups requested from Spotify, empty means album and single
+	IncludeGroups []string `json:"include_groups,omitempty"`
+	// Album types kept for normal and for priority artists, empty keeps all
+	AlbumTypes         []string `json:"album_types,omitempty"`
+	PriorityAlbumTypes []string `json:"priority_album_types,omitempty"`
+	// Releases are kept only if a followed artist is the main one
+	MainArtistOnly bool `json:"main_artist_only,omitempty"`
+	// Zone of schedules and check dates, see ParseTimezone
+	Timezone   string     `json:"timezone,omitempty"`
+	QuietHours QuietHours `json:"quiet_hours"`
+}
+
+// migrateKeywords turns excluded keywords into exclude rules for album titles
+func (s *Settings) migrateKeywords() {
+	for _, keyword := range s.ExcludeKeywords {
+		if keyword != "" {
+			s.TitleRules = append(s.TitleRules, TitleRule{Action: RuleExclude, Field: RuleAlbum, Pattern: keyword})
+		}
+	}
+	s.ExcludeKeywords = nil
+}
+
+// ArtistLevel returns the level of the artist with the given id
+func (s *Settings) ArtistLevel(artistId string) string {
+	if artist, ok := s.Artists[artistId]; ok && artist.Level != "" {
+		return artist.Level
+	}
+	return LevelNormal
+}
+
+// SetArtistLevel changes the level of the artist. Artists with the normal
+// level are not stored
+func (s *Settings) SetArtistLevel(artistId, name, level string) {
+	if level == LevelNormal {
+		delete(s.Artists, artistId)
+		return
+	}
+	if s.Artists == nil {
+		s.Artists = make(map[string]ArtistSettings)
+	}
+	s.Artists[artistId] = ArtistSettings{Name: name, Level: level}
+}
+
+// clone copies the user with settings, so the copy can be changed without
+// locking the DB
+func (u *User) clone() User {
+	userCopy := *u
+	if u.Settings.Artists != nil {
+		userCopy.Settings.Artists = make(map[string]ArtistSettings, len(u.Settings.Artists))
+		for id, artist := range u.Settings.Artists {
+			userCopy.Settings.Artists[id] = artist
+		}
+	}
+	userCopy.Settings.TitleRules = append([]TitleRule(nil), u.Settings.TitleRules...)
+	userCopy.Settings.IncludeGroups = append([]string(nil), u.Settings.IncludeGroups...)
+	userCopy.Settings.AlbumTypes = append([]string(nil), u.Settings.AlbumTypes...)
+	userCopy.Settings.PriorityAlbumTypes = append([]string(nil), u.Settings.PriorityAlbumTypes...)
+	userCopy.PendingDigest = append([]DigestRelease(nil), u.PendingDigest...)
+	return userCopy
+}
+
+const (
+	CheckRunning     = "running"
+	CheckOk          = "ok"
+	CheckFailed      = "error"
+	CheckCanceled    = "canceled"
+	CheckInterrupted = "interrupted"
+)
+
+// CheckRecord is an entry of the check history
+type CheckRecord struct {
+	Id       string    `json:"id"`
+	UserId   int       `json:"user_id"`
+	Trigger  string    `json:"trigger"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Status   string    `json:"status"`
+	Releases int       `json:"releases"`
+	Filtered int       `json:"filtered"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Notification is an entry of the ledger of releases sent to users
+type Notification struct {
+	UserId    int           `json:"user_id"`
+	ChatId    int           `json:"chat_id"`
+	CheckId   string        `json:"check_id"`
+	MessageId int           `json:"message_id,omitempty"`
+	Sent      time.Time     `json:"sent"`
+	Album     spotify.Album `json:"album"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Digest is a sent summary of releases, kept to turn its pages
+type Digest struct {
+	Id        string          `json:"id"`
+	UserId    int             `json:"user_id"`
+	ChatId    int             `json:"chat_id"`
+	MessageId int             `json:"message_id"`
+	Sent      time.Time       `json:"sent"`
+	Albums    []spotify.Album `json:"albums"`
+}
+
+type saveData struct {
+	Users         []User         `json:"users"`
+	Checks        []CheckRecord  `json:"checks"`
+	Notifications []Notification `json:"notifications"`
+	Digests       []Digest       `json:"digests"`
 }
 
 type DB struct {
-	user     *User
-	saveFile string
-	mu       sync.Mutex
+	users         map[int]*User
+	checks        []CheckRecord
+	notifications []Notification
+	digests       []Digest
+	saveFile      string
+	mu            sync.Mutex
 }
 
 func NewDB(saveFile string) DB {
-	return DB{saveFile: saveFile}
+	return DB{saveFile: saveFile, users: make(map[int]*User)}
 }
 
 func (db *DB) Load() error {
@@ -35,7 +229,7 @@ func (db *DB) Load() error {
 
 	jsonFile, err := os.Open(db.saveFile)
 	if err != nil {
-		logger.Error.Printf("can't open save file: %v\n", err)
+		slog.Warn("can't open save file", "error", err)
 		return nil
 	}
 	defer jsonFile.Close()
@@ -44,37 +238,66 @@ func (db *DB) Load() error {
 	if err != nil {
 		return fmt.Errorf("can't read save file: %w", err)
 	}
-	user := &User{}
-	err = json.Unmarshal(byteValue, user)
+	data := &saveData{}
+	err = json.Unmarshal(byteValue, data)
 	if err != nil {
 		return fmt.Errorf("wrong save file format: %w", err)
 	}
-	db.user = user
+	if data.Users == nil {
+		// Save file of a single user bot
+		user := &User{}
+		err = json.Unmarshal(byteValue, user)
+		if err != nil {
+			return fmt.Errorf("wrong save file format: %w", err)
+		}
+		if user.UserId != 0 {
+			data.Users = []User{*user}
+		}
+	}
+
+	db.users = make(map[int]*User)
+	for i := range data.Users {
+		data.Users[i].Settings.migrateKeywords()
+		db.users[data.Users[i].UserId] = &data.Users[i]
+	}
+	for i := range data.Checks {
+		// The bot was stopped during these checks
+		if data.Checks[i].Status == CheckRunning {
+			data.Checks[i].Status = CheckInterrupted
+		}
+	}
+	db.checks = data.Checks
+	db.notifications = data.Notifications
+	db.digests = data.Digests
 	return nil
 }
 
 func (db *DB) Save() error {
-	if db.user == nil {
-		return nil
-	}
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
+	data := saveData{
+		Users:         db.usersList(),
+		Checks:        db.checks,
+		Notifications: db.notifications,
+		Digests:       db.digests,
+	}
+	byteValue, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return fmt.Errorf("can't marshal save data: %w", err)
+	}
+
 	jsonFile, err := os.Create(db.saveFile)
 	if err != nil {
 		return fmt.Errorf("can't open save file: %w", err)
 	}
 	defer jsonFile.Close()
 
-	byteValue, err := json.MarshalIndent(db.user, "", "    ")
-	if err != nil {
-		return fmt.Errorf("can't marshal save data: %w", err)
-	}
 	_, err = jsonFile.Write(byteValue)
 	if err != nil {
 		return fmt.Errorf("can't write into save file: %w", err)
 	}
-	logger.General.Println("db saved")
+	slog.Debug("db saved")
 	return nil
 }
 
@@ -82,16 +305,137 @@ func (db *DB) Set(newUser User) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	db.user = &newUser
+	db.users[newUser.UserId] = &newUser
 }
 
-func (db *DB) Get() *User {
+// Get returns a copy of the user or nil if there is no such user
+func (db *DB) Get(userId int) *User {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	if db.user == nil {
+	user, ok := db.users[userId]
+	if !ok {
 		return nil
 	}
-	userCopy := *db.user
+	userCopy := user.clone()
 	return &userCopy
 }
+
+// Update changes the stored user in place. It returns false if there is no
+// such user
+func (db *DB) Update(userId int, update func(user *User)) bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return false
+	}
+	update(user)
+	return true
+}
+
+// Users returns copies of all users ordered by id
+func (db *DB) Users() []User {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.usersList()
+}
+
+func (db *DB) usersList() []User {
+	users := make([]User, 0, len(db.users))
+	for _, user := range db.users {
+		users = append(users, user.clone())
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserId < users[j].UserId })
+	return users
+}
+
+// SaveCheck adds the check to the history or replaces the entry with the
+// same id
+func (db *DB) SaveCheck(check CheckRecord) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i := len(db.checks) - 1; i >= 0; i-- {
+		if db.checks[i].Id == check.Id {
+			db.checks[i] = check
+			return
+		}
+	}
+	db.checks = append(db.checks, check)
+	if len(db.checks) > maxChecks {
+		db.checks = db.checks[len(db.checks)-maxChecks:]
+	}
+}
+
+// Checks returns up to limit latest checks of the user, the newest first.
+// Zero userId selects checks of all users, zero limit selects all checks
+func (db *DB) Checks(userId int, limit int) []CheckRecord {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	checks := []CheckRecord{}
+	for i := len(db.checks) - 1; i >= 0; i-- {
+		if limit > 0 && len(checks) == limit {
+			break
+		}
+		if userId == 0 || db.checks[i].UserId == userId {
+			checks = append(checks, db.checks[i])
+		}
+	}
+	return checks
+}
+
+func (db *DB) AddNotification(notification Notification) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.notifications = append(db.notifications, notification)
+	if len(db.notifications) > maxNotifications {
+		db.notifications = db.notifications[len(db.notifications)-maxNotifications:]
+	}
+}
+
+// Notifications returns up to limit latest notifications of the user, the
+// newest first. Zero userId and limit work as in Checks
+func (db *DB) Notifications(userId int, limit int) []Notification {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	notifications := []Notification{}
+	for i := len(db.notifications) - 1; i >= 0; i-- {
+		if limit > 0 && len(notifications) == limit {
+			break
+		}
+		if userId == 0 || db.notifications[i].UserId == userId {
+			notifications = append(notifications, db.notifications[i])
+		}
+	}
+	return notifications
+}
+
+func (db *DB) AddDigest(digest Digest) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.digests = append(db.digests, digest)
+	if len(db.digests) > maxDigests {
+		db.digests = db.digests[len(db.digests)-maxDigests:]
+	}
+}
+
+// Digest returns the sent digest with the id or nil if it is too old
+func (db *DB) Digest(id string) *Digest {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i := len(db.digests) - 1; i >= 0; i-- {
+		if db.digests[i].Id == id {
+			digest := db.digests[i]
+			return &digest
+		}
+	}
+	return nil
+}
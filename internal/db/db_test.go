@@ -0,0 +1,180 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_LoadSingleUserFile(t *testing.T) {
+	saveFile := filepath.Join(t.TempDir(), "save.json")
+	legacy := `{"user_id": 5, "chat_id": 6, "token": {"AccessToken": "token"}, "last_check": "2024-03-01T10:00:00Z"}`
+	if err := os.WriteFile(saveFile, []byte(legacy), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewDB(saveFile)
+	if err := db.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	user := db.Get(5)
+	if user == nil || user.ChatId != 6 || user.Token.AccessToken != "token" {
+		t.Fatalf("Get() = %+v", user)
+	}
+
+	if err := db.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	db = NewDB(saveFile)
+	if err := db.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if users := db.Users(); len(users) != 1 || users[0].UserId != 5 {
+		t.Errorf("Users() after save = %+v", users)
+	}
+}
+
+func Test_Checks(t *testing.T) {
+	saveFile := filepath.Join(t.TempDir(), "save.json")
+	db := NewDB(saveFile)
+	db.SaveCheck(CheckRecord{Id: "a", UserId: 1, Status: CheckOk})
+	db.SaveCheck(CheckRecord{Id: "b", UserId: 2, Status: CheckOk})
+	db.SaveCheck(CheckRecord{Id: "c", UserId: 1, Status: CheckRunning})
+
+	tests := []struct {
+		name   string
+		userId int
+		limit  int
+		want   []string
+	}{
+		{name: "all", want: []string{"c", "b", "a"}},
+		{name: "user", userId: 1, want: []string{"c", "a"}},
+		{name: "limit", limit: 2, want: []string{"c", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checks := db.Checks(tt.userId, tt.limit)
+			if len(checks) != len(tt.want) {
+				t.Fatalf("Checks() = %+v, want ids %v", checks, tt.want)
+			}
+			for i := range checks {
+				if checks[i].Id != tt.want[i] {
+					t.Errorf("Checks()[%d].Id = %s, want %s", i, checks[i].Id, tt.want[i])
+				}
+			}
+		})
+	}
+
+	db.SaveCheck(CheckRecord{Id: "a", UserId: 1, Status: CheckFailed})
+	if checks := db.Checks(0, 0); len(checks) != 3 || checks[2].Status != CheckFailed {
+		t.Errorf("SaveCheck() didn't replace the entry: %+v", checks)
+	}
+
+	// Checks running while the bot stopped are marked on load
+	if err := db.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded := NewDB(saveFile)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if checks := loaded.Checks(1, 1); checks[0].Status != CheckInterrupted {
+		t.Errorf("Load() check status = %s, want %s", checks[0].Status, CheckInterrupted)
+	}
+}
+
+func Test_Digests(t *testing.T) {
+	db := NewDB(filepath.Join(t.TempDir(), "save.json"))
+	for i := 0; i < maxDigests+1; i++ {
+		db.AddDigest(Digest{Id: strconv.Itoa(i), UserId: 1})
+	}
+	if db.Digest("0") != nil {
+		t.Errorf("Digest() returned an entry over the limit")
+	}
+	if digest := db.Digest(strconv.Itoa(maxDigests)); digest == nil || digest.UserId != 1 {
+		t.Errorf("Digest() = %+v", digest)
+	}
+}
+
+func Test_ParseTimezone(t *testing.T) {
+	tests := []struct {
+		name       string
+		timezone   string
+		wantName   string
+		wantOffset int
+		wantErr    bool
+	}{
+		{name: "empty", timezone: "", wantName: "UTC"},
+		{name: "iana", timezone: "Asia/Tokyo", wantName: "Asia/Tokyo", wantOffset: 9 * 60 * 60},
+		{name: "utc offset", timezone: "UTC+3", wantName: "UTC+03:00", wantOffset: 3 * 60 * 60},
+		{name: "negative minutes", timezone: "-03:30", wantName: "UTC-03:30", wantOffset: -(3*60 + 30) * 60},
+		{name: "stored name", timezone: "UTC+05:45", wantName: "UTC+05:45", wantOffset: (5*60 + 45) * 60},
+		{name: "too far", timezone: "UTC+15", wantErr: true},
+		{name: "unknown", timezone: "Mars/Olympus", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location, err := ParseTimezone(tt.timezone)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimezone(%q) error = %v, wantErr %v", tt.timezone, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			_, offset := time.Date(2024, 1, 15, 12, 0, 0, 0, location).Zone()
+			if location.String() != tt.wantName || offset != tt.wantOffset {
+				t.Errorf("ParseTimezone(%q) = %s with offset %d, want %s with %d", tt.timezone, location, offset, tt.wantName, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func Test_QuietHoursActive(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 8, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name  string
+		quiet QuietHours
+		t     time.Time
+		want  bool
+	}{
+		{name: "disabled", quiet: QuietHours{}, t: at(3, 0), want: false},
+		{name: "overnight late", quiet: QuietHours{Start: "22:00", End: "08:00"}, t: at(23, 30), want: true},
+		{name: "overnight early", quiet: QuietHours{Start: "22:00", End: "08:00"}, t: at(7, 59), want: true},
+		{name: "overnight end", quiet: QuietHours{Start: "22:00", End: "08:00"}, t: at(8, 0), want: false},
+		{name: "daytime", quiet: QuietHours{Start: "13:00", End: "14:30"}, t: at(14, 0), want: true},
+		{name: "daytime outside", quiet: QuietHours{Start: "13:00", End: "14:30"}, t: at(12, 59), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.quiet.Active(tt.t); got != tt.want {
+				t.Errorf("Active(%s) = %v, want %v", tt.t.Format("15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_LoadExcludeKeywords(t *testing.T) {
+	saveFile := filepath.Join(t.TempDir(), "save.json")
+	saved := `{"users": [{"user_id": 5, "settings": {"exclude_keywords": ["karaoke", ""], "title_rules": [{"action": "include", "field": "track", "pattern": "remix"}]}}]}`
+	if err := os.WriteFile(saveFile, []byte(saved), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewDB(saveFile)
+	if err := db.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	settings := db.Get(5).Settings
+	want := []TitleRule{
+		{Action: RuleInclude, Field: RuleTrack, Pattern: "remix"},
+		{Action: RuleExclude, Field: RuleAlbum, Pattern: "karaoke"},
+	}
+	if len(settings.ExcludeKeywords) != 0 || !reflect.DeepEqual(settings.TitleRules, want) {
+		t.Errorf("settings = %+v, want title rules %+v", settings, want)
+	}
+}
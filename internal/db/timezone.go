@@ -0,0 +1,118 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseTimezone reads an IANA zone name like Europe/Berlin or a fixed offset
+// like UTC+3 or +05:30. Empty name is UTC
+func ParseTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return time.UTC, nil
+	}
+	offset := strings.TrimPrefix(strings.TrimPrefix(name, "UTC"), "GMT")
+	if offset != "" && (offset[0] == '+' || offset[0] == '-') {
+		seconds, err := parseOffset(offset)
+		if err != nil {
+			return nil, fmt.Errorf("wrong offset %q: %w", name, err)
+		}
+		return FixedTimezone(seconds), nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	return location, nil
+}
+
+// FixedTimezone creates a zone with the offset, named as ParseTimezone
+// accepts it
+func FixedTimezone(seconds int) *time.Location {
+	sign := '+'
+	if seconds < 0 {
+		sign = '-'
+	}
+	minutes := seconds / 60
+	if minutes < 0 {
+		minutes = -minutes
+	}
+	return time.FixedZone(fmt.Sprintf("UTC%c%02d:%02d", sign, minutes/60, minutes%60), seconds)
+}
+
+func parseOffset(offset string) (int, error) {
+	sign := 1
+	if offset[0] == '-' {
+		sign = -1
+	}
+	hoursText, minutesText, hasMinutes := strings.Cut(offset[1:], ":")
+	hours, err := strconv.Atoi(hoursText)
+	if err != nil || hours > 14 {
+		return 0, fmt.Errorf("hours must be 0-14")
+	}
+	minutes := 0
+	if hasMinutes {
+		minutes, err = strconv.Atoi(minutesText)
+		if err != nil || minutes < 0 || minutes > 59 {
+			return 0, fmt.Errorf("minutes must be 0-59")
+		}
+	}
+	return sign * (hours*60*60 + minutes*60), nil
+}
+
+// Location returns the timezone of the user, UTC if it is not set or unknown
+func (s *Settings) Location() *time.Location {
+	location, err := ParseTimezone(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// What happens to notifications during quiet hours
+const (
+	QuietHold   = "hold"
+	QuietSilent = "silent"
+)
+
+// QuietHours is a daily period in the timezone of the user. Start and End are
+// in the 15:04 form, the period can span midnight
+type QuietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Mode  string `json:"mode"`
+}
+
+// ParseClock reads the time of day in the 15:04 form as minutes since midnight
+func ParseClock(text string) (int, error) {
+	t, err := time.Parse("15:04", text)
+	if err != nil {
+		return 0, fmt.Errorf("wrong time %q, expected HH:MM", text)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Enabled tells if the period is set and not empty
+func (q *QuietHours) Enabled() bool {
+	start, errStart := ParseClock(q.Start)
+	end, errEnd := ParseClock(q.End)
+	return errStart == nil && errEnd == nil && start != end
+}
+
+// Active tells if the time is within quiet hours. The time must be in the
+// timezone of the user
+func (q *QuietHours) Active(t time.Time) bool {
+	if !q.Enabled() {
+		return false
+	}
+	start, _ := ParseClock(q.Start)
+	end, _ := ParseClock(q.End)
+	now := t.Hour()*60 + t.Minute()
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
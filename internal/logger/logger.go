@@ -2,66 +2,214 @@ package logger
 
 import (
 	"TeleBotNotifications/internal/config"
+	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
-const OFF = 0
-const ERROR_ONLY = 1
-const FULL = 2
+// LevelOff disables a sink
+const LevelOff = slog.Level(100)
 
-var General *log.Logger
-var Error *log.Logger
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var logFile *RotatingFile
+var telegramSink *TelegramSink
 
-var logFile *os.File
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "off", "":
+		return LevelOff, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return LevelOff, fmt.Errorf("unknown log level %q", level)
+}
 
-func init() {
-	General = log.New(os.Stdout, "\x1b[37m", log.Ldate|log.Ltime)
-	Error = log.New(os.Stderr, "\x1b[31mError:\t", log.Ldate|log.Ltime|log.Llongfile)
+func newHandler(w io.Writer, conf config.SinkConfig, color bool) (slog.Handler, error) {
+	level, err := ParseLevel(conf.Level)
+	if err != nil {
+		return nil, err
+	}
+	options := &slog.HandlerOptions{
+		AddSource: level <= slog.LevelDebug,
+		Level:     level,
+	}
+	switch conf.Format {
+	case FormatJSON:
+		return slog.NewJSONHandler(w, options), nil
+	case FormatText, "":
+		if color {
+			options.ReplaceAttr = colorLevel
+		}
+		return slog.NewTextHandler(w, options), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", conf.Format)
 }
 
+// Setup replaces the default slog logger with one writing into stdout, a log
+// file and Telegram according to the config
 func Setup(conf *config.LoggerConfig, telegramBot io.Writer) error {
-	var generalWrites []io.Writer
-	var errorWriters []io.Writer
+	var handlers []slog.Handler
 
-	if conf.StdLogLevel >= ERROR_ONLY {
-		errorWriters = append(errorWriters, os.Stderr)
-	}
-	if conf.StdLogLevel == FULL {
-		generalWrites = append(generalWrites, os.Stdout)
+	if level, _ := ParseLevel(conf.Std.Level); level != LevelOff {
+		handler, err := newHandler(os.Stdout, conf.Std, isTerminal(os.Stdout))
+		if err != nil {
+			return fmt.Errorf("std logger: %w", err)
+		}
+		handlers = append(handlers, handler)
 	}
 
-	if conf.FileLogLevel >= ERROR_ONLY {
-		err := createLogFile(conf.Path)
+	if level, _ := ParseLevel(conf.File.Level); level != LevelOff {
+		err := createLogFile(conf.Path, conf.Rotation)
 		if err != nil {
 			return err
 		}
-		errorWriters = append(errorWriters, logFile)
+		handler, err := newHandler(logFile, conf.File, false)
+		if err != nil {
+			return fmt.Errorf("file logger: %w", err)
+		}
+		handlers = append(handlers, handler)
+	}
+
+	if level, _ := ParseLevel(conf.Telegram.Level); level != LevelOff {
+		var fallback io.Writer = os.Stderr
+		if logFile != nil {
+			fallback = logFile
+		}
+		telegramSink = NewTelegramSink(func(text string) error {
+			_, err := telegramBot.Write([]byte(text))
+			return err
+		}, fallback, time.Duration(conf.TelegramFlushSeconds)*time.Second, time.Duration(conf.TelegramDedupMinutes)*time.Minute)
+		handler, err := newHandler(telegramSink, conf.Telegram, false)
+		if err != nil {
+			return fmt.Errorf("telegram logger: %w", err)
+		}
+		handlers = append(handlers, handler)
+	}
+
+	slog.SetDefault(slog.New(&fanoutHandler{handlers: handlers}))
+	return nil
+}
+
+// Reopen opens the log file again after it was moved, on SIGHUP
+func Reopen() error {
+	if logFile == nil {
+		return nil
+	}
+	return logFile.Reopen()
+}
+
+// Close sends lines collected for Telegram and closes the log file
+func Close() {
+	if telegramSink != nil {
+		telegramSink.Close()
+	}
+	if logFile != nil {
+		logFile.Close()
 	}
-	if conf.FileLogLevel == FULL {
-		generalWrites = append(generalWrites, logFile)
+}
+
+type contextKey struct{}
+
+// With returns a context carrying attributes added to every record logged
+// with it, e.g. check_id of a running check
+func With(ctx context.Context, args ...any) context.Context {
+	attrs, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	record := slog.Record{}
+	record.Add(args...)
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, contextKey{}, attrs[:len(attrs):len(attrs)])
+}
+
+// fanoutHandler passes records to every handler enabled for their level
+type fanoutHandler struct {
+	handlers []slog.Handler
+}
+
+func (h *fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
 	}
+	return false
+}
 
-	if conf.TelegramLogLevel >= ERROR_ONLY {
-		errorWriters = append(errorWriters, telegramBot)
+func (h *fanoutHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(contextKey{}).([]slog.Attr); ok {
+		record = record.Clone()
+		record.AddAttrs(attrs...)
 	}
-	if conf.TelegramLogLevel == FULL {
-		generalWrites = append(generalWrites, telegramBot)
+	var err error
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, record.Level) {
+			if handlerErr := handler.Handle(ctx, record.Clone()); handlerErr != nil {
+				err = handlerErr
+			}
+		}
 	}
+	return err
+}
 
-	generalWriter := io.MultiWriter(generalWrites...)
-	errorWriter := io.MultiWriter(errorWriters...)
+func (h *fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make([]slog.Handler, 0, len(h.handlers))
+	for _, handler := range h.handlers {
+		handlers = append(handlers, handler.WithAttrs(attrs))
+	}
+	return &fanoutHandler{handlers: handlers}
+}
 
-	General = log.New(generalWriter, "\x1b[37m", log.Ldate|log.Ltime)
-	Error = log.New(errorWriter, "\x1b[31mError:\t", log.Ldate|log.Ltime|log.Llongfile)
+func (h *fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make([]slog.Handler, 0, len(h.handlers))
+	for _, handler := range h.handlers {
+		handlers = append(handlers, handler.WithGroup(name))
+	}
+	return &fanoutHandler{handlers: handlers}
+}
 
-	return nil
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
-func createLogFile(folderPath string) (err error) {
+func colorLevel(groups []string, a slog.Attr) slog.Attr {
+	if a.Key != slog.LevelKey || len(groups) != 0 {
+		return a
+	}
+	level, ok := a.Value.Any().(slog.Level)
+	if !ok {
+		return a
+	}
+	color := "\x1b[37m"
+	switch {
+	case level >= slog.LevelError:
+		color = "\x1b[31m"
+	case level >= slog.LevelWarn:
+		color = "\x1b[33m"
+	case level >= slog.LevelInfo:
+		color = "\x1b[34m"
+	}
+	return slog.String(a.Key, color+level.String()+"\x1b[0m")
+}
+
+func createLogFile(folderPath string, rotation config.RotationConfig) (err error) {
 	_, err = os.Stat(folderPath)
 	if os.IsNotExist(err) {
 		err = os.MkdirAll(folderPath, 0766)
@@ -76,12 +224,6 @@ func createLogFile(folderPath string) (err error) {
 		return fmt.Errorf("error accessing a folder: %s", err.Error())
 	}
 
-	currentTime := time.Now()
-	logFileName := fmt.Sprintf("%s/%s.log", folderPath, currentTime.Format("2006-01-02_15-04-05"))
-
-	logFile, err = os.OpenFile(logFileName, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		return fmt.Errorf("error creating and opening file: %s", err.Error())
-	}
-	return nil
+	logFile, err = NewRotatingFile(filepath.Join(folderPath, "bot.log"), rotation)
+	return err
 }
@@ -0,0 +1,263 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"TeleBotNotifications/internal/config"
+)
+
+func newTestSink(send func(string) error, fallback *bytes.Buffer) *TelegramSink {
+	return &TelegramSink{
+		send:     send,
+		fallback: fallback,
+		interval: time.Second,
+		window:   10 * time.Minute,
+		seen:     make(map[string]*repeatedLine),
+	}
+}
+
+func Test_TelegramSinkDedup(t *testing.T) {
+	var sent []string
+	sink := newTestSink(func(text string) error {
+		sent = append(sent, text)
+		return nil
+	}, &bytes.Buffer{})
+
+	start := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 38; i++ {
+		now := start.Add(time.Duration(i) * time.Second)
+		sink.add(now.Format("2006/01/02 15:04:05")+" main.go:1: request failed\n", now)
+	}
+	sink.add("2023/01/01 12:01:00 main.go:2: other error\n", start.Add(time.Minute))
+	sink.flush(start.Add(time.Minute), false)
+
+	if len(sent) != 1 || strings.Count(sent[0], "request failed") != 1 || !strings.Contains(sent[0], "other error") {
+		t.Fatalf("Unexpected first batch %q", sent)
+	}
+
+	sink.flush(start.Add(11*time.Minute), false)
+	if len(sent) != 2 || !strings.HasPrefix(sent[1], "same line x37 in last 10m0s: ") {
+		t.Fatalf("Unexpected summary %q", sent)
+	}
+}
+
+func Test_TelegramSinkFallback(t *testing.T) {
+	calls := 0
+	fallback := &bytes.Buffer{}
+	sink := newTestSink(func(text string) error {
+		calls++
+		return errors.New("telegram is down")
+	}, fallback)
+
+	now := time.Now()
+	sink.add("first\n", now)
+	sink.flush(now, false)
+	sink.add("second\n", now)
+	sink.flush(now.Add(time.Second), false)
+
+	if calls != 1 {
+		t.Errorf("Expected 1 send attempt while telegram is down, got %d", calls)
+	}
+	if !strings.Contains(fallback.String(), "first") || !strings.Contains(fallback.String(), "second") {
+		t.Errorf("Lines are lost, fallback contains %q", fallback.String())
+	}
+}
+
+func Test_TelegramSinkClose(t *testing.T) {
+	sent := make(chan string, 1)
+	sink := NewTelegramSink(func(text string) error {
+		sent <- text
+		return nil
+	}, &bytes.Buffer{}, time.Hour, time.Hour)
+
+	sink.Write([]byte("line\n"))
+	sink.Close()
+
+	select {
+	case text := <-sent:
+		if text != "line" {
+			t.Errorf("Expected %q, got %q", "line", text)
+		}
+	default:
+		t.Error("Lines are not sent on close")
+	}
+}
+
+func Test_fanoutHandler(t *testing.T) {
+	var info, errorsOnly bytes.Buffer
+	infoHandler, err := newHandler(&info, config.SinkConfig{Level: "info", Format: FormatJSON}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorHandler, err := newHandler(&errorsOnly, config.SinkConfig{Level: "error", Format: FormatText}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := slog.New(&fanoutHandler{handlers: []slog.Handler{infoHandler, errorHandler}})
+
+	ctx := With(context.Background(), "check_id", "abc")
+	log.InfoContext(ctx, "checking", "user_id", 1)
+	log.ErrorContext(ctx, "failed", "artist_id", "2")
+	log.Debug("hidden")
+
+	if strings.Count(info.String(), "\n") != 2 || !strings.Contains(info.String(), `"check_id":"abc"`) || !strings.Contains(info.String(), `"user_id":1`) {
+		t.Errorf("Unexpected info output %q", info.String())
+	}
+	if strings.Count(errorsOnly.String(), "\n") != 1 || !strings.Contains(errorsOnly.String(), "artist_id=2 check_id=abc") {
+		t.Errorf("Unexpected error output %q", errorsOnly.String())
+	}
+}
+
+func Test_ParseLevel(t *testing.T) {
+	for _, level := range []string{"debug", "info", "warn", "error", "off", "OFF", ""} {
+		if _, err := ParseLevel(level); err != nil {
+			t.Errorf("Level %q: %v", level, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Error expected")
+	}
+}
+
+func Test_RotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bot.log")
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	f, err := NewRotatingFile(path, config.RotationConfig{MaxFiles: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.now = func() time.Time { return now }
+	f.maxSize = 10
+
+	for i := 0; i < 4; i++ {
+		now = now.Add(time.Second)
+		if _, err := f.Write([]byte("12345678\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.cleanups.Wait()
+
+	backups, err := f.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 retained files, got %v", backups)
+	}
+	for _, backup := range backups {
+		if !strings.HasSuffix(backup, ".log.gz") {
+			t.Errorf("File %s is not compressed", backup)
+		}
+	}
+	if !strings.Contains(backups[1], "2023-01-01T12-00-04") {
+		t.Errorf("Newest file is not retained: %v", backups)
+	}
+}
+
+func Test_RotatingFileAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.log")
+	now := time.Now()
+
+	f, err := NewRotatingFile(path, config.RotationConfig{MaxAgeHours: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.now = func() time.Time { return now }
+
+	f.Write([]byte("old\n"))
+	now = now.Add(2 * time.Hour)
+	f.Write([]byte("new\n"))
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "new\n" {
+		t.Errorf("Expected only new line in active file, got %q", content)
+	}
+}
+
+func Test_RotatingFileRenameFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bot.log")
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	f, err := NewRotatingFile(path, config.RotationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.now = func() time.Time { return now }
+	f.maxSize = 10
+
+	// A directory in place of the rotated file makes the rename fail
+	blocked := filepath.Join(dir, "bot-"+now.Format(backupTimeFormat)+".log")
+	if err := os.MkdirAll(filepath.Join(blocked, "file"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"12345678\n", "rotation\n", "retry\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), "12345678\nlog file rotation failed") || !strings.HasSuffix(string(content), "rotation\nretry\n") {
+		t.Errorf("Expected writes to the old file after a failed rotation, got %q", content)
+	}
+
+	// Rotation is tried again later
+	now = now.Add(rotationRetry)
+	if _, err := f.Write([]byte("rotated\n")); err != nil {
+		t.Fatal(err)
+	}
+	content, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "rotated\n" {
+		t.Errorf("Expected a new file after the retry, got %q", content)
+	}
+}
+
+func Test_RotatingFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bot.log")
+
+	f, err := NewRotatingFile(path, config.RotationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("before\n"))
+	if err := os.Rename(path, filepath.Join(dir, "moved.log")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("after\n"))
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "after\n" {
+		t.Errorf("Expected new file after reopen, got %q", content)
+	}
+}
@@ -0,0 +1,257 @@
+package logger
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"TeleBotNotifications/internal/config"
+)
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// A failed rotation is tried again after this time, logging goes on to the
+// current file meanwhile
+const rotationRetry = time.Minute
+
+// RotatingFile appends to a log file and moves it aside once it grows over the
+// size limit or gets older than the age limit. Zero limits disable rotation
+// of that kind and zero MaxFiles keeps every rotated file
+type RotatingFile struct {
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	maxFiles int
+	compress bool
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	// No rotation before this time after a failed one
+	retryAt time.Time
+	now     func() time.Time
+
+	// Compression and removal of rotated files run in the background one at
+	// a time
+	cleanupMu sync.Mutex
+	cleanups  sync.WaitGroup
+}
+
+func NewRotatingFile(path string, conf config.RotationConfig) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:     path,
+		maxSize:  int64(conf.MaxSizeMB) * 1024 * 1024,
+		maxAge:   time.Duration(conf.MaxAgeHours) * time.Hour,
+		maxFiles: int(conf.MaxFiles),
+		compress: conf.Compress,
+		now:      time.Now,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("error creating and opening file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error reading file info: %w", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = f.now()
+	if f.size > 0 {
+		// Age of an existing file counts from its last change, the creation
+		// time is not available everywhere
+		f.opened = info.ModTime()
+	}
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.size > 0 && f.needsRotation(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			if f.file == nil {
+				return 0, err
+			}
+			f.retryAt = f.now().Add(rotationRetry)
+			fmt.Fprintf(f.file, "log file rotation failed: %s\n", err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) needsRotation(incoming int64) bool {
+	if f.now().Before(f.retryAt) {
+		return false
+	}
+	if f.maxSize > 0 && f.size+incoming > f.maxSize {
+		return true
+	}
+	return f.maxAge > 0 && f.now().Sub(f.opened) >= f.maxAge
+}
+
+// Rotate moves the current file aside and starts a new one
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotate()
+}
+
+// rotate moves the file aside and opens a new one. If the file can't be
+// moved, the current one is opened again. The file is nil only if it can't be
+// opened at all
+func (f *RotatingFile) rotate() error {
+	closeErr := f.file.Close()
+	ext := filepath.Ext(f.path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(f.path, ext), f.now().Format(backupTimeFormat), ext)
+	if err := os.Rename(f.path, backup); err != nil {
+		err = fmt.Errorf("error renaming log file: %w", err)
+		if openErr := f.open(); openErr != nil {
+			f.file = nil
+			return errors.Join(err, openErr)
+		}
+		return err
+	}
+	if err := f.open(); err != nil {
+		f.file = nil
+		return err
+	}
+	if closeErr != nil {
+		fmt.Fprintf(f.file, "closing rotated log file failed: %s\n", closeErr)
+	}
+
+	f.cleanups.Add(1)
+	go f.cleanup(backup)
+	return nil
+}
+
+// cleanup compresses the rotated file and removes the oldest ones without
+// holding up writes
+func (f *RotatingFile) cleanup(backup string) {
+	defer f.cleanups.Done()
+	f.cleanupMu.Lock()
+	defer f.cleanupMu.Unlock()
+
+	if f.compress {
+		if err := compressFile(backup); err != nil {
+			f.report("log file compression failed: %s\n", err)
+		}
+	}
+	if err := f.removeOld(); err != nil {
+		f.report("old log files removal failed: %s\n", err)
+	}
+}
+
+// report writes a problem of the background cleanup to the log file
+func (f *RotatingFile) report(format string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil {
+		fmt.Fprintf(f.file, format, err)
+	}
+}
+
+// Reopen closes and opens the file again, e.g. after it was moved by an
+// external tool
+func (f *RotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file != nil {
+		f.file.Close()
+	}
+	return f.open()
+}
+
+// Close waits for the background cleanup and closes the file
+func (f *RotatingFile) Close() error {
+	f.cleanups.Wait()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// backups returns rotated files from the oldest to the newest
+func (f *RotatingFile) backups() ([]string, error) {
+	ext := filepath.Ext(f.path)
+	matches, err := filepath.Glob(strings.TrimSuffix(f.path, ext) + "-*" + ext + "*")
+	if err != nil {
+		return nil, err
+	}
+	// Timestamps in names sort in time order
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func (f *RotatingFile) removeOld() error {
+	if f.maxFiles <= 0 {
+		return nil
+	}
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > f.maxFiles {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+func compressFile(path string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(destination)
+	if _, err = io.Copy(writer, source); err != nil {
+		destination.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		destination.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err = destination.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
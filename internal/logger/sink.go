@@ -0,0 +1,168 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultFlushInterval = 10 * time.Second
+const defaultDedupWindow = 10 * time.Minute
+const sinkBufferSize = 1024
+
+// Retry sending after the fallback was used no earlier than this
+const sinkRetryDelay = time.Minute
+
+// Date and time of a record, ignored when comparing lines
+var logTimestamp = regexp.MustCompile(`\d{4}[-/]\d{2}[-/]\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})?`)
+
+type repeatedLine struct {
+	line  string
+	first time.Time
+	count int
+}
+
+// TelegramSink is an io.Writer which collects lines and sends them in
+// batches. Repeated lines are collapsed into a single summary, and lines are
+// written to the fallback while sending fails. Writes never block on sending
+type TelegramSink struct {
+	send     func(text string) error
+	fallback io.Writer
+	interval time.Duration
+	window   time.Duration
+
+	lines  chan string
+	stop   chan struct{}
+	done   chan struct{}
+	mu     sync.RWMutex
+	closed bool
+
+	// Accessed from the sink goroutine only
+	batch     []string
+	seen      map[string]*repeatedLine
+	downUntil time.Time
+}
+
+func NewTelegramSink(send func(text string) error, fallback io.Writer, interval, window time.Duration) *TelegramSink {
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	if window <= 0 {
+		window = defaultDedupWindow
+	}
+	s := &TelegramSink{
+		send:     send,
+		fallback: fallback,
+		interval: interval,
+		window:   window,
+		lines:    make(chan string, sinkBufferSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		seen:     make(map[string]*repeatedLine),
+	}
+	go s.run()
+	return s
+}
+
+func (s *TelegramSink) Write(p []byte) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return s.fallback.Write(p)
+	}
+
+	select {
+	case s.lines <- string(p):
+	default:
+		// Buffer is full, sending can't keep up
+		return s.fallback.Write(p)
+	}
+	return len(p), nil
+}
+
+// Close sends collected lines and stops the sink
+func (s *TelegramSink) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+	<-s.done
+}
+
+func (s *TelegramSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case line := <-s.lines:
+			s.add(line, time.Now())
+		case <-ticker.C:
+			s.flush(time.Now(), false)
+		case <-s.stop:
+			for {
+				select {
+				case line := <-s.lines:
+					s.add(line, time.Now())
+				default:
+					s.flush(time.Now(), true)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *TelegramSink) add(line string, now time.Time) {
+	line = strings.TrimRight(line, "\n")
+	key := logTimestamp.ReplaceAllString(line, "")
+
+	repeated, ok := s.seen[key]
+	if ok && now.Sub(repeated.first) < s.window {
+		repeated.count++
+		return
+	}
+	if ok {
+		s.summarize(repeated)
+	}
+	s.seen[key] = &repeatedLine{line: line, first: now}
+	s.batch = append(s.batch, line)
+}
+
+func (s *TelegramSink) summarize(repeated *repeatedLine) {
+	if repeated.count > 0 {
+		s.batch = append(s.batch, fmt.Sprintf("same line x%d in last %s: %s", repeated.count, s.window, repeated.line))
+	}
+}
+
+// flush sends the batch. Summaries of repeated lines are added once their
+// window ends, or for every line on the final flush
+func (s *TelegramSink) flush(now time.Time, final bool) {
+	for key, repeated := range s.seen {
+		if final || now.Sub(repeated.first) >= s.window {
+			s.summarize(repeated)
+			delete(s.seen, key)
+		}
+	}
+	if len(s.batch) == 0 {
+		return
+	}
+	text := strings.Join(s.batch, "\n")
+	s.batch = nil
+
+	if now.Before(s.downUntil) {
+		io.WriteString(s.fallback, text+"\n")
+		return
+	}
+	if err := s.send(text); err != nil {
+		s.downUntil = now.Add(sinkRetryDelay)
+		// Failure is not logged, it would come back into the sink
+		fmt.Fprintf(s.fallback, "telegram log sink failed, using fallback for %s: %s\n%s\n", sinkRetryDelay, err, text)
+	}
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_Write(t *testing.T) {
+	registry := NewRegistry()
+	counter := &CounterVec{desc: desc{name: "requests_total", help: "Requests.", labels: []string{"endpoint", "status"}}, values: map[string]float64{}}
+	gauge := &GaugeVec{desc: desc{name: "last_check", help: "Last check."}, values: map[string]float64{}}
+	histogram := &HistogramVec{desc: desc{name: "duration_seconds", help: "Duration."}, buckets: []float64{0.1, 1}, values: map[string]*histogramValue{}}
+	registry.register(counter)
+	registry.register(gauge)
+	registry.register(histogram)
+
+	counter.Inc("/v1/me", "200")
+	counter.Add(2, "/v1/me", "200")
+	counter.Inc(`/a"b`, "error")
+	gauge.Set(1700000000)
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	var out bytes.Buffer
+	registry.Write(&out)
+	want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{endpoint="/a\"b",status="error"} 1
+requests_total{endpoint="/v1/me",status="200"} 3
+# HELP last_check Last check.
+# TYPE last_check gauge
+last_check 1.7e+09
+# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{le="0.1"} 1
+duration_seconds_bucket{le="1"} 2
+duration_seconds_bucket{le="+Inf"} 3
+duration_seconds_sum 5.55
+duration_seconds_count 3
+`
+	if out.String() != want {
+		t.Errorf("\nexpected\n%s\ngot\n%s", want, out.String())
+	}
+}
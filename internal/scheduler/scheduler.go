@@ -0,0 +1,192 @@
+// Package scheduler runs jobs on cron expressions or intervals. Runs missed
+// while the process was stopped are caught up once, and runs of different
+// jobs are spread with a jitter
+package scheduler
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Longest sleep between checks of due jobs. Timers don't count time of a
+// suspended machine, waking up regularly notices such jumps
+const maxWait = time.Minute
+
+// Clock gives the current time and timers, tests replace it
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+var RealClock Clock = realClock{}
+
+// RunFunc is called with the planned time of the run, without the jitter
+type RunFunc func(planned time.Time)
+
+type entry struct {
+	schedule Schedule
+	location *time.Location
+	run      RunFunc
+	// Planned time of the next run and the same time with the jitter
+	next time.Time
+	due  time.Time
+}
+
+type Scheduler struct {
+	clock  Clock
+	jitter time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*entry
+	wake chan struct{}
+}
+
+// New creates a scheduler. Every job runs up to jitter later than planned,
+// the delay is the same for every run of a job
+func New(clock Clock, jitter time.Duration) *Scheduler {
+	if clock == nil {
+		clock = RealClock
+	}
+	return &Scheduler{
+		clock:  clock,
+		jitter: jitter,
+		jobs:   make(map[string]*entry),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// offset returns the jitter of the job
+func (s *Scheduler) offset(key string) time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return time.Duration(h.Sum64() % uint64(s.jitter))
+}
+
+// Set adds the job or replaces the job with the same key. The schedule is
+// evaluated in the location, nil means the local time. last is the time of
+// the previous run. If runs were missed since then, the job runs once as soon
+// as possible
+func (s *Scheduler) Set(key string, schedule Schedule, location *time.Location, last time.Time, run RunFunc) {
+	if location == nil {
+		location = time.Local
+	}
+	s.mu.Lock()
+	e := &entry{schedule: schedule, location: location, run: run}
+	now := s.clock.Now()
+	if last.IsZero() {
+		last = now
+	}
+	e.next = schedule.Next(last.In(location))
+	if !e.next.IsZero() && e.next.Before(now) {
+		slog.Debug("scheduler catches up a missed run", "job", key, "planned", e.next)
+		e.next = now
+	}
+	e.due = e.next.Add(s.offset(key))
+	s.jobs[key] = e
+	s.mu.Unlock()
+	s.notify()
+}
+
+func (s *Scheduler) Remove(key string) {
+	s.mu.Lock()
+	delete(s.jobs, key)
+	s.mu.Unlock()
+	s.notify()
+}
+
+// Next returns the time of the next run of the job with the jitter
+func (s *Scheduler) Next(key string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.jobs[key]
+	if !ok || e.next.IsZero() {
+		return time.Time{}, false
+	}
+	return e.due, true
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+type dueRun struct {
+	key     string
+	run     RunFunc
+	planned time.Time
+}
+
+// popDue returns jobs due at now and plans their next runs. It also returns
+// the time until the earliest next run
+func (s *Scheduler) popDue(now time.Time) ([]dueRun, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var runs []dueRun
+	wait := maxWait
+	for key, e := range s.jobs {
+		if e.next.IsZero() {
+			continue
+		}
+		if !e.due.After(now) {
+			runs = append(runs, dueRun{key: key, run: e.run, planned: e.next})
+			// The next run follows the planned time, so the jitter doesn't
+			// add up. Runs missed while the job was running are skipped
+			offset := s.offset(key)
+			for {
+				e.next = e.schedule.Next(e.next.In(e.location))
+				if e.next.IsZero() || e.next.Add(offset).After(now) {
+					break
+				}
+			}
+			if e.next.IsZero() {
+				continue
+			}
+			e.due = e.next.Add(offset)
+		}
+		if until := e.due.Sub(now); until < wait {
+			wait = until
+		}
+	}
+	return runs, wait
+}
+
+// Run calls due jobs until the context is canceled. Jobs run one by one,
+// long jobs should start their work in the background
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		runs, wait := s.popDue(s.clock.Now())
+		for _, r := range runs {
+			slog.Debug("scheduled run", "job", r.key, "planned", r.planned)
+			r.run(r.planned)
+		}
+		if len(runs) > 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(wait):
+		case <-s.wake:
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{name: "cron", spec: "30 9 * * 1-5"},
+		{name: "lists and steps", spec: "0,30 */2 1-15/7 * 0,7"},
+		{name: "descriptor", spec: "@weekly"},
+		{name: "every", spec: "@every 6h"},
+		{name: "duration", spec: "90m"},
+		{name: "short interval", spec: "@every 10s", wantErr: true},
+		{name: "too few fields", spec: "* * * *", wantErr: true},
+		{name: "out of range", spec: "60 * * * *", wantErr: true},
+		{name: "reversed range", spec: "* 5-1 * * *", wantErr: true},
+		{name: "wrong step", spec: "*/0 * * * *", wantErr: true},
+		{name: "names", spec: "0 0 * * MON", wantErr: true},
+		{name: "unknown descriptor", spec: "@sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_Next(t *testing.T) {
+	zone := time.FixedZone("UTC+3", 3*60*60)
+	date := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, zone)
+	}
+
+	tests := []struct {
+		name  string
+		spec  string
+		after time.Time
+		want  time.Time
+	}{
+		{name: "workdays", spec: "30 9 * * 1-5", after: date(2024, 3, 8, 10, 0), want: date(2024, 3, 11, 9, 30)},
+		{name: "same day", spec: "30 9 * * 1-5", after: date(2024, 3, 8, 9, 29), want: date(2024, 3, 8, 9, 30)},
+		{name: "not the same minute", spec: "30 9 * * *", after: date(2024, 3, 8, 9, 30), want: date(2024, 3, 9, 9, 30)},
+		{name: "daily", spec: "@daily", after: date(2024, 12, 31, 23, 59), want: date(2025, 1, 1, 0, 0)},
+		{name: "step", spec: "*/15 * * * *", after: date(2024, 3, 8, 10, 16), want: date(2024, 3, 8, 10, 30)},
+		{name: "leap day", spec: "0 0 29 2 *", after: date(2024, 3, 1, 0, 0), want: date(2028, 2, 29, 0, 0)},
+		{name: "day of month or week", spec: "0 12 15 * 1", after: date(2024, 3, 12, 0, 0), want: date(2024, 3, 15, 12, 0)},
+		{name: "sunday as 7", spec: "0 8 * * 7", after: date(2024, 3, 8, 0, 0), want: date(2024, 3, 10, 8, 0)},
+		{name: "interval", spec: "@every 6h", after: date(2024, 3, 8, 22, 0), want: date(2024, 3, 9, 4, 0)},
+		{name: "never", spec: "0 0 31 2 *", after: date(2024, 3, 8, 0, 0), want: time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := schedule.Next(tt.after); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// fakeClock moves only when advanced
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+	waiting chan struct{}
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, waiting: make(chan struct{}, 100)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+	} else {
+		c.waiters = append(c.waiters, waiter{at: c.now.Add(d), ch: ch})
+	}
+	c.waiting <- struct{}{}
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = waiters
+}
+
+// blockUntilWaiting returns once the scheduler waits for the clock
+func (c *fakeClock) blockUntilWaiting(t *testing.T) {
+	select {
+	case <-c.waiting:
+	case <-time.After(time.Second):
+		t.Fatal("scheduler doesn't wait for the clock")
+	}
+}
+
+// advanceTo moves the clock by minutes until the time, letting the scheduler
+// run between steps
+func (c *fakeClock) advanceTo(t *testing.T, until time.Time) {
+	for c.Now().Before(until) {
+		c.blockUntilWaiting(t)
+		step := until.Sub(c.Now())
+		if step > maxWait {
+			step = maxWait
+		}
+		c.Advance(step)
+	}
+}
+
+func expectRun(t *testing.T, runs chan time.Time, want time.Time) {
+	select {
+	case planned := <-runs:
+		if !planned.Equal(want) {
+			t.Errorf("run planned at %s, want %s", planned, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no run planned at %s", want)
+	}
+}
+
+func expectNoRun(t *testing.T, runs chan time.Time) {
+	select {
+	case planned := <-runs:
+		t.Errorf("unexpected run planned at %s", planned)
+	default:
+	}
+}
+
+func Test_SchedulerCatchUp(t *testing.T) {
+	start := time.Date(2024, 3, 8, 10, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	s := New(clock, 0)
+	daily, _ := Parse("@daily")
+
+	runs := make(chan time.Time, 10)
+	// The last run was three days ago, the missed runs are caught up once
+	s.Set("user:1", daily, time.UTC, start.AddDate(0, 0, -3), func(planned time.Time) { runs <- planned })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	expectRun(t, runs, start)
+	clock.advanceTo(t, time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC).Add(-time.Minute))
+	expectNoRun(t, runs)
+	clock.advanceTo(t, time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC))
+	expectRun(t, runs, time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC))
+}
+
+func Test_SchedulerJitter(t *testing.T) {
+	start := time.Date(2024, 3, 8, 23, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	jitter := 10 * time.Minute
+	s := New(clock, jitter)
+	daily, _ := Parse("@daily")
+
+	runs := make(chan time.Time, 10)
+	keys := []string{"user:1", "user:2", "user:3"}
+	offsets := make(map[time.Duration]bool)
+	for _, key := range keys {
+		s.Set(key, daily, time.UTC, start, func(planned time.Time) { runs <- planned })
+		due, ok := s.Next(key)
+		offset := due.Sub(time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC))
+		if !ok || offset < 0 || offset >= jitter {
+			t.Errorf("Next(%s) = %s, want within %s after midnight", key, due, jitter)
+		}
+		offsets[offset] = true
+	}
+	if len(offsets) == 1 {
+		t.Errorf("every job has the same jitter")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	clock.advanceTo(t, time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC).Add(jitter))
+	for range keys {
+		// Planned time doesn't include the jitter
+		expectRun(t, runs, time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC))
+	}
+}
+
+func Test_SchedulerIntervalJitter(t *testing.T) {
+	start := time.Date(2024, 3, 8, 10, 0, 0, 0, time.UTC)
+	jitter := 10 * time.Minute
+	s := New(newFakeClock(start), jitter)
+	every, _ := Parse("6h")
+	s.Set("user:1", every, time.UTC, start, func(time.Time) {})
+	offset := s.offset("user:1")
+	if offset == 0 {
+		t.Fatal("the job has no jitter")
+	}
+
+	// Runs are planned from the previous planned time, not from the run
+	for i := 1; i <= 4; i++ {
+		planned := start.Add(time.Duration(i) * 6 * time.Hour)
+		runs, _ := s.popDue(planned.Add(offset))
+		if len(runs) != 1 || !runs[0].planned.Equal(planned) {
+			t.Fatalf("run %d = %+v, want planned at %s", i, runs, planned)
+		}
+	}
+	due, _ := s.Next("user:1")
+	if want := start.Add(30 * time.Hour).Add(offset); !due.Equal(want) {
+		t.Errorf("Next() = %s, want %s", due, want)
+	}
+
+	// A late run skips runs that are already due
+	late := start.Add(30*time.Hour + 13*time.Hour)
+	if runs, _ := s.popDue(late); len(runs) != 1 {
+		t.Fatalf("late runs = %+v", runs)
+	}
+	due, _ = s.Next("user:1")
+	if want := start.Add(48 * time.Hour).Add(offset); !due.Equal(want) {
+		t.Errorf("Next() after a late run = %s, want %s", due, want)
+	}
+}
+
+func Test_SchedulerRemove(t *testing.T) {
+	start := time.Date(2024, 3, 8, 10, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	s := New(clock, 0)
+	hourly, _ := Parse("@hourly")
+
+	runs := make(chan time.Time, 10)
+	s.Set("job", hourly, nil, start, func(planned time.Time) { runs <- planned })
+	s.Remove("job")
+	if _, ok := s.Next("job"); ok {
+		t.Errorf("Next() of removed job is known")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	clock.advanceTo(t, start.Add(2*time.Hour))
+	expectNoRun(t, runs)
+}
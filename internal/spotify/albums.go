@@ -1,6 +1,7 @@
 package spotify
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,18 +9,8 @@ import (
 	"strconv"
 )
 
-type getAlbumTracksResponse struct {
-	Href     string            `json:"href"`
-	Limit    int               `json:"limit"`
-	Offset   int               `json:"offset"`
-	Next     *string           `json:"next"`
-	Previous *string           `json:"previous"`
-	Total    int               `json:"total"`
-	Tracks   []SimplifiedTrack `json:"items"`
-}
-
 // TODO: arguments does not make sense
-func (c *Client) GetAlbumTracks(token *OAuth2Token, albumId string, limit, offset uint64, market *string) ([]SimplifiedTrack, error) {
+func (c *Client) GetAlbumTracks(token *OAuth2Token, albumId string, limit, offset uint64, market *string, ctx context.Context) ([]SimplifiedTrack, error) {
 	if limit < 1 || 50 > limit {
 		return nil, fmt.Errorf("limit %d is out range 1-50", limit)
 	}
@@ -43,28 +34,57 @@ func (c *Client) GetAlbumTracks(token *OAuth2Token, albumId string, limit, offse
 			return nil, err
 		}
 
-		request, err := http.NewRequest(http.MethodGet, *requestURL, nil)
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, *requestURL, nil)
 		if err != nil {
 			return nil, err
 		}
 		request.Header.Add("Authorization", "Bearer  "+token.AccessToken)
 
 		response, err := c.client.Do(request)
-		if err != nil || response.StatusCode != http.StatusOK {
-			explanation := &errorResponse{}
-			if err := json.NewDecoder(response.Body).Decode(explanation); err != nil {
-				return nil, fmt.Errorf("http error %s, cant  decode response %s", response.Status, err)
-			}
-			return nil, fmt.Errorf("http request fail: %s, %s", response.Status, explanation.Error.Message)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode != http.StatusOK {
+			err = decodeErrorResponse(response)
+			response.Body.Close()
+			return nil, err
 		}
 
-		var tracksPart getAlbumTracksResponse
+		var tracksPart TrackPage
 		err = json.NewDecoder(response.Body).Decode(&tracksPart)
+		response.Body.Close()
 		if err != nil {
 			return nil, err
 		}
-		tracks = append(tracks, tracksPart.Tracks...)
+		tracks = append(tracks, tracksPart.Items...)
 		requestURL = tracksPart.Next
 	}
 	return tracks, nil
 }
+
+// GetAlbum returns the album with the first page of its tracks
+func (c *Client) GetAlbum(token *OAuth2Token, albumId string, ctx context.Context) (*FullAlbum, error) {
+	if err := c.checkToken(token); err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/v1/albums/%s", apiUrl, url.PathEscape(albumId)), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("Authorization", "Bearer  "+token.AccessToken)
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, decodeErrorResponse(response)
+	}
+
+	album := &FullAlbum{}
+	if err := json.NewDecoder(response.Body).Decode(album); err != nil {
+		return nil, fmt.Errorf("error decoding album: %w", err)
+	}
+	return album, nil
+}
@@ -1,99 +1,46 @@
 package spotify
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
-	"time"
+	"strings"
 )
 
 
-func (c *Client) GetFollowedArtists(token *OAuth2Token) ([]Artist, error) {
-	return c.getFollowedArtists(token, 50)
+func (c *Client) GetFollowedArtists(token *OAuth2Token, ctx context.Context) ([]Artist, error) {
+	return c.getFollowedArtists(token, 50, ctx)
 }
 
 
-type image struct {
-	Url    string `json:"url"`
-	Height int    `json:"height"`
-	Width  int    `json:"width"`
-}
-
-type album struct {
-	Id           string `json:"id"`
-	AlbumType    string `json:"album_type"`
-	ExternalUrls struct {
-		Spotify string `json:"spotify"`
-	} `json:"external_urls"`
-	Images               []image  `json:"images"`
-	Name                 string   `json:"name"`
-	ReleaseDate          string   `json:"release_date"`
-	ReleaseDatePrecision string   `json:"release_date_precision"`
-	Uri                  string   `json:"uri"`
-	Artists              []Artist `json:"artists"`
-	AlbumGroup           string   `json:"album_group"`
-}
-
-type getArtistAlbumsResponse struct {
-	Next   *string `json:"next"`
-	Albums []album `json:"items"`
-}
-
 func decodeAlbulmsResponse(response *http.Response) ([]Album, *string, error) {
 	defer response.Body.Close()
 	if response.StatusCode != http.StatusOK {
 		return nil, nil, fmt.Errorf("unexpected status code: %s", response.Status)
 	}
 
-	responseData := &getArtistAlbumsResponse{}
-	err := json.NewDecoder(response.Body).Decode(responseData)
+	page := &AlbumPage{}
+	err := json.NewDecoder(response.Body).Decode(page)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	albums := make([]Album, 0, len(responseData.Albums))
-	for i := 0; i < len(responseData.Albums); i++ {
-		var t time.Time
-		if responseData.Albums[i].ReleaseDatePrecision == "day" {
-			t, err = time.Parse("2006-01-02", responseData.Albums[i].ReleaseDate)
-			if err != nil {
-				return nil, nil, fmt.Errorf("error parsing date: %s", err)
-			}
-		} else if responseData.Albums[i].ReleaseDatePrecision == "month" {
-			t, err = time.Parse("2006-01", responseData.Albums[i].ReleaseDate)
-			if err != nil {
-				return nil, nil, fmt.Errorf("error parsing date: %s", err)
-			}
-		} else if responseData.Albums[i].ReleaseDatePrecision == "year" {
-			t, err = time.Parse("2006", responseData.Albums[i].ReleaseDate)
-			if err != nil {
-				return nil, nil, fmt.Errorf("error parsing date: %s", err)
-			}
-		}
-
-		album := Album{
-			Id:         responseData.Albums[i].Id,
-			Name:       responseData.Albums[i].Name,
-			AlbumType:  responseData.Albums[i].AlbumType,
-			AlbumGroup: responseData.Albums[i].AlbumGroup,
-			Url:        responseData.Albums[i].ExternalUrls.Spotify,
-			Uri:        responseData.Albums[i].Uri,
-			// ImageUrl:    responseData.Albums[i].Images[0].Url,
-			ReleaseDate: t,
-			Artists:     responseData.Albums[i].Artists,
-		}
-		if len(responseData.Albums[i].Images) > 0 {
-			album.ImageUrl = responseData.Albums[i].Images[0].Url
+	albums := make([]Album, 0, len(page.Items))
+	for _, item := range page.Items {
+		album, err := item.Album()
+		if err != nil {
+			return nil, nil, err
 		}
 		albums = append(albums, album)
 	}
 
-	return albums, responseData.Next, nil
+	return albums, page.Next, nil
 }
 
-func (c *Client) getArtistAlbums(token *OAuth2Token, artistId string, include_groups string, requestLimit uint) ([]Album, error) {
+func (c *Client) getArtistAlbums(token *OAuth2Token, artistId string, include_groups string, requestLimit uint, ctx context.Context) ([]Album, error) {
 	getRequestUrl := func() (*string, error) {
 		params := url.Values{
 			"include_groups": {include_groups},
@@ -126,14 +73,17 @@ func (c *Client) getArtistAlbums(token *OAuth2Token, artistId string, include_gr
 			token = refreshed_token
 		}
 
-		request, err := http.NewRequest(http.MethodGet, *requestUrl, nil)
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, *requestUrl, nil)
 		if err != nil {
 			return nil, err
 		}
 		request.Header.Add("Authorization", "Bearer  "+token.AccessToken)
 
 		response, err := c.client.Do(request)
-		if err != nil || response.StatusCode != http.StatusOK {
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode != http.StatusOK {
 			explanation := &errorResponse{}
 			if err := json.NewDecoder(response.Body).Decode(explanation); err != nil {
 				return nil, fmt.Errorf("http error %s, cant  decode response %s", response.Status, err)
@@ -151,7 +101,11 @@ func (c *Client) getArtistAlbums(token *OAuth2Token, artistId string, include_gr
 	return albums, nil
 }
 
-// album,single,compilation,appears_on
-func (c *Client) GetArtistAlbums(token *OAuth2Token, artist *Artist) ([]Album, error) {
-	return c.getArtistAlbums(token, artist.Id, "album,single", 50)
+// GetArtistAlbums returns releases of the artist in the groups, empty groups
+// mean DefaultIncludeGroups
+func (c *Client) GetArtistAlbums(token *OAuth2Token, artist *Artist, includeGroups []string, ctx context.Context) ([]Album, error) {
+	if len(includeGroups) == 0 {
+		includeGroups = DefaultIncludeGroups
+	}
+	return c.getArtistAlbums(token, artist.Id, strings.Join(includeGroups, ","), 50, ctx)
 }
\ No newline at end of file
@@ -129,8 +129,10 @@ func (c *Client) refreshAccessToken(token *OAuth2Token) (*OAuth2Token, error) {
 
 	new_token, err := decodeTokenResponse(response)
 	if err != nil {
+		tokenRefreshesTotal.Inc("error")
 		return nil, err
 	}
+	tokenRefreshesTotal.Inc("ok")
 	if new_token.RefreshToken == "" {
 		new_token.RefreshToken = token.RefreshToken
 	}
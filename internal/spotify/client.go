@@ -23,7 +23,7 @@ func NewClient(config *config.SpotifyConfig) (*Client, error) {
 	}
 
 	return &Client{
-		client:        &http.Client{},
+		client:        &http.Client{Transport: &instrumentedTransport{next: http.DefaultTransport}},
 		clientId:      config.ClientId,
 		authorization: base64.StdEncoding.EncodeToString([]byte(config.ClientId + ":" + config.ClientSecret)),
 		redirectUri:   config.RedirectUri,
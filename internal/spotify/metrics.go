@@ -0,0 +1,95 @@
+package spotify
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"TeleBotNotifications/internal/metrics"
+)
+
+var (
+	requestsTotal = metrics.NewCounterVec("spotify_requests_total",
+		"Spotify API requests by endpoint and response status.", "endpoint", "status")
+	requestDuration = metrics.NewHistogramVec("spotify_request_duration_seconds",
+		"Spotify API request latency.", metrics.DefaultBuckets, "endpoint")
+	retriesTotal = metrics.NewCounterVec("spotify_retries_total",
+		"Spotify API requests repeated after rate limiting.", "endpoint")
+	rateLimitedTotal = metrics.NewCounterVec("spotify_rate_limited_total",
+		"Spotify API responses with status 429.", "endpoint")
+	tokenRefreshesTotal = metrics.NewCounterVec("spotify_token_refreshes_total",
+		"Access token refreshes by result.", "result")
+	artistsScannedTotal = metrics.NewCounterVec("spotify_artists_scanned_total",
+		"Followed artists checked for new releases.")
+)
+
+const maxRateLimitRetries = 3
+const maxRetryAfter = time.Minute
+
+// Spotify IDs are base62 strings of 22 characters
+var idSegment = regexp.MustCompile(`/[0-9A-Za-z]{22}(/|$)`)
+
+// endpoint replaces IDs in the path to keep the number of label values small
+func endpoint(path string) string {
+	return idSegment.ReplaceAllString(path, "/{id}$1")
+}
+
+// instrumentedTransport counts requests and repeats rate limited ones after
+// the time given in Retry-After. Repeated requests are clones with a new body,
+// the request of the caller is not changed
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	name := endpoint(request.URL.Path)
+	attemptRequest := request
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		response, err := t.next.RoundTrip(attemptRequest)
+		requestDuration.Observe(time.Since(start).Seconds(), name)
+		if err != nil {
+			requestsTotal.Inc(name, "error")
+			return nil, err
+		}
+		requestsTotal.Inc(name, strconv.Itoa(response.StatusCode))
+		if response.StatusCode != http.StatusTooManyRequests {
+			return response, nil
+		}
+		rateLimitedTotal.Inc(name)
+
+		retryAfter, err := strconv.Atoi(response.Header.Get("Retry-After"))
+		wait := time.Duration(retryAfter) * time.Second
+		if err != nil || wait > maxRetryAfter || attempt == maxRateLimitRetries {
+			return response, nil
+		}
+		attemptRequest = request.Clone(request.Context())
+		if request.Body != nil {
+			if request.GetBody == nil {
+				return response, nil
+			}
+			if attemptRequest.Body, err = request.GetBody(); err != nil {
+				return response, nil
+			}
+		}
+		response.Body.Close()
+		retriesTotal.Inc(name)
+
+		if err := sleep(request.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
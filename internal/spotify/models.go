@@ -0,0 +1,207 @@
+package spotify
+
+import (
+	"fmt"
+	"time"
+)
+
+// Objects of the Web API, see
+// https://developer.spotify.com/documentation/web-api/reference
+
+type Image struct {
+	Url    string `json:"url"`
+	Height int    `json:"height"`
+	Width  int    `json:"width"`
+}
+
+type Followers struct {
+	// Always null, the Web API doesn't support it yet
+	Href  *string `json:"href"`
+	Total int     `json:"total"`
+}
+
+// Copyright types
+const (
+	CopyrightC = "C"
+	// Copyright of the sound recording
+	CopyrightP = "P"
+)
+
+type Copyright struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+// Restrictions tells why the content is not available: market, product or
+// explicit
+type Restrictions struct {
+	Reason string `json:"reason"`
+}
+
+type ExternalIds struct {
+	Isrc string `json:"isrc,omitempty"`
+	Ean  string `json:"ean,omitempty"`
+	Upc  string `json:"upc,omitempty"`
+}
+
+type SimplifiedArtist struct {
+	ExternalUrls ExternalUrls `json:"external_urls"`
+	Href         string       `json:"href"`
+	Id           string       `json:"id"`
+	Name         string       `json:"name"`
+	Type         string       `json:"type"`
+	Uri          string       `json:"uri"`
+}
+
+// Artist returns the part of the artist kept with releases
+func (a SimplifiedArtist) Artist() Artist {
+	return Artist{Id: a.Id, Name: a.Name, Uri: a.Uri, ExternalUrls: a.ExternalUrls}
+}
+
+type FullArtist struct {
+	SimplifiedArtist
+	Followers  Followers `json:"followers"`
+	Genres     []string  `json:"genres"`
+	Images     []Image   `json:"images"`
+	Popularity int       `json:"popularity"`
+}
+
+type SimplifiedAlbum struct {
+	AlbumType            string             `json:"album_type"`
+	TotalTracks          int                `json:"total_tracks"`
+	AvailableMarkets     []string           `json:"available_markets"`
+	ExternalUrls         ExternalUrls       `json:"external_urls"`
+	Href                 string             `json:"href"`
+	Id                   string             `json:"id"`
+	Images               []Image            `json:"images"`
+	Name                 string             `json:"name"`
+	ReleaseDate          string             `json:"release_date"`
+	ReleaseDatePrecision string             `json:"release_date_precision"`
+	Restrictions         *Restrictions      `json:"restrictions,omitempty"`
+	Type                 string             `json:"type"`
+	Uri                  string             `json:"uri"`
+	Artists              []SimplifiedArtist `json:"artists"`
+	// Set only in albums of an artist
+	AlbumGroup string `json:"album_group,omitempty"`
+}
+
+var releaseDateLayouts = map[string]string{
+	"day":   "2006-01-02",
+	"month": "2006-01",
+	"year":  "2006",
+}
+
+// Album returns the release as it is kept and shown. The release date is the
+// first day of the period for month and year precisions
+func (a SimplifiedAlbum) Album() (Album, error) {
+	album := Album{
+		Id:                   a.Id,
+		Name:                 a.Name,
+		AlbumType:            a.AlbumType,
+		AlbumGroup:           a.AlbumGroup,
+		Url:                  a.ExternalUrls.Spotify,
+		Uri:                  a.Uri,
+		ReleaseDatePrecision: a.ReleaseDatePrecision,
+		TotalTracks:          a.TotalTracks,
+	}
+	if layout, ok := releaseDateLayouts[a.ReleaseDatePrecision]; ok {
+		var err error
+		album.ReleaseDate, err = time.Parse(layout, a.ReleaseDate)
+		if err != nil {
+			return Album{}, fmt.Errorf("error parsing date: %s", err)
+		}
+	}
+	if len(a.Images) > 0 {
+		album.ImageUrl = a.Images[0].Url
+	}
+	for _, artist := range a.Artists {
+		album.Artists = append(album.Artists, artist.Artist())
+	}
+	return album, nil
+}
+
+type FullAlbum struct {
+	SimplifiedAlbum
+	Tracks      TrackPage   `json:"tracks"`
+	Copyrights  []Copyright `json:"copyrights"`
+	ExternalIds ExternalIds `json:"external_ids"`
+	// Deprecated by Spotify, always empty
+	Genres     []string `json:"genres"`
+	Label      string   `json:"label"`
+	Popularity int      `json:"popularity"`
+}
+
+// TrackLink points to the track requested when track relinking gave another
+// one available in the market
+type TrackLink struct {
+	ExternalUrls ExternalUrls `json:"external_urls"`
+	Href         string       `json:"href"`
+	Id           string       `json:"id"`
+	Type         string       `json:"type"`
+	Uri          string       `json:"uri"`
+}
+
+type SimplifiedTrack struct {
+	Artists          []SimplifiedArtist `json:"artists"`
+	AvailableMarkets []string           `json:"available_markets"`
+	DiscNumber       int                `json:"disc_number"`
+	DurationMs       int                `json:"duration_ms"`
+	Explicit         bool               `json:"explicit"`
+	ExternalUrls     ExternalUrls       `json:"external_urls"`
+	Href             string             `json:"href"`
+	Id               string             `json:"id"`
+	// Set only with a market in the request
+	IsPlayable   bool          `json:"is_playable"`
+	LinkedFrom   *TrackLink    `json:"linked_from,omitempty"`
+	Restrictions *Restrictions `json:"restrictions,omitempty"`
+	Name         string        `json:"name"`
+	// Deprecated by Spotify, null for most tracks
+	PreviewUrl  *string `json:"preview_url"`
+	TrackNumber int     `json:"track_number"`
+	Type        string  `json:"type"`
+	Uri         string  `json:"uri"`
+	IsLocal     bool    `json:"is_local"`
+}
+
+type FullTrack struct {
+	SimplifiedTrack
+	Album       SimplifiedAlbum `json:"album"`
+	ExternalIds ExternalIds     `json:"external_ids"`
+	Popularity  int             `json:"popularity"`
+}
+
+type TrackPage struct {
+	Href     string            `json:"href"`
+	Limit    int               `json:"limit"`
+	Next     *string           `json:"next"`
+	Offset   int               `json:"offset"`
+	Previous *string           `json:"previous"`
+	Total    int               `json:"total"`
+	Items    []SimplifiedTrack `json:"items"`
+}
+
+type AlbumPage struct {
+	Href     string            `json:"href"`
+	Limit    int               `json:"limit"`
+	Next     *string           `json:"next"`
+	Offset   int               `json:"offset"`
+	Previous *string           `json:"previous"`
+	Total    int               `json:"total"`
+	Items    []SimplifiedAlbum `json:"items"`
+}
+
+type Cursors struct {
+	After  string `json:"after"`
+	Before string `json:"before"`
+}
+
+// ArtistCursorPage is a page of followed artists, pages are linked by cursors
+// instead of offsets
+type ArtistCursorPage struct {
+	Href    string       `json:"href"`
+	Limit   int          `json:"limit"`
+	Next    *string      `json:"next"`
+	Cursors Cursors      `json:"cursors"`
+	Total   int          `json:"total"`
+	Items   []FullArtist `json:"items"`
+}
@@ -0,0 +1,217 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const fullArtistJSON = `{
+	"external_urls": {"spotify": "https://open.spotify.com/artist/0TnOYISbd1XYRBk9myaseg"},
+	"followers": {"href": null, "total": 10384012},
+	"genres": ["dance pop", "pop"],
+	"href": "https://api.spotify.com/v1/artists/0TnOYISbd1XYRBk9myaseg",
+	"id": "0TnOYISbd1XYRBk9myaseg",
+	"images": [{"url": "https://i.scdn.co/image/artist", "height": 640, "width": 640}],
+	"name": "Pitbull",
+	"popularity": 82,
+	"type": "artist",
+	"uri": "spotify:artist:0TnOYISbd1XYRBk9myaseg"
+}`
+
+const fullAlbumJSON = `{
+	"album_type": "compilation",
+	"total_tracks": 2,
+	"available_markets": ["CA", "BR", "IT"],
+	"external_urls": {"spotify": "https://open.spotify.com/album/4aawyAB9vmqN3uQ7FjRGTy"},
+	"href": "https://api.spotify.com/v1/albums/4aawyAB9vmqN3uQ7FjRGTy",
+	"id": "4aawyAB9vmqN3uQ7FjRGTy",
+	"images": [{"url": "https://i.scdn.co/image/album", "height": null, "width": null}],
+	"name": "Global Warming",
+	"release_date": "2012-11",
+	"release_date_precision": "month",
+	"restrictions": {"reason": "market"},
+	"type": "album",
+	"uri": "spotify:album:4aawyAB9vmqN3uQ7FjRGTy",
+	"artists": [{
+		"external_urls": {"spotify": "https://open.spotify.com/artist/0TnOYISbd1XYRBk9myaseg"},
+		"href": "https://api.spotify.com/v1/artists/0TnOYISbd1XYRBk9myaseg",
+		"id": "0TnOYISbd1XYRBk9myaseg",
+		"name": "Pitbull",
+		"type": "artist",
+		"uri": "spotify:artist:0TnOYISbd1XYRBk9myaseg"
+	}],
+	"tracks": {
+		"href": "https://api.spotify.com/v1/albums/4aawyAB9vmqN3uQ7FjRGTy/tracks?offset=0&limit=1",
+		"limit": 1,
+		"next": "https://api.spotify.com/v1/albums/4aawyAB9vmqN3uQ7FjRGTy/tracks?offset=1&limit=1",
+		"offset": 0,
+		"previous": null,
+		"total": 2,
+		"items": [{
+			"artists": [{"id": "0TnOYISbd1XYRBk9myaseg", "name": "Pitbull", "type": "artist", "uri": "spotify:artist:0TnOYISbd1XYRBk9myaseg"}],
+			"available_markets": ["CA"],
+			"disc_number": 1,
+			"duration_ms": 85400,
+			"explicit": true,
+			"external_urls": {"spotify": "https://open.spotify.com/track/6OmhkSOpvYBokMKQxpIGx2"},
+			"href": "https://api.spotify.com/v1/tracks/6OmhkSOpvYBokMKQxpIGx2",
+			"id": "6OmhkSOpvYBokMKQxpIGx2",
+			"is_playable": true,
+			"linked_from": {"id": "2gbA4cPhiIl4kyf0Oj4ghk", "type": "track", "uri": "spotify:track:2gbA4cPhiIl4kyf0Oj4ghk"},
+			"name": "Global Warming (feat. Sensato)",
+			"preview_url": null,
+			"track_number": 1,
+			"type": "track",
+			"uri": "spotify:track:6OmhkSOpvYBokMKQxpIGx2",
+			"is_local": false
+		}]
+	},
+	"copyrights": [{"text": "(C) 2012 RCA Records", "type": "C"}, {"text": "(P) 2012 RCA Records", "type": "P"}],
+	"external_ids": {"upc": "886443671584"},
+	"genres": [],
+	"label": "Mr.305/Polo Grounds Music/RCA Records",
+	"popularity": 57
+}`
+
+const fullTrackJSON = `{
+	"album": {
+		"album_type": "single",
+		"total_tracks": 1,
+		"id": "1dUMRVQNHE3DYDhi6Ydh8o",
+		"name": "Single",
+		"release_date": "2024",
+		"release_date_precision": "year",
+		"type": "album",
+		"uri": "spotify:album:1dUMRVQNHE3DYDhi6Ydh8o",
+		"artists": []
+	},
+	"artists": [{"id": "0TnOYISbd1XYRBk9myaseg", "name": "Pitbull"}],
+	"disc_number": 1,
+	"duration_ms": 203000,
+	"explicit": false,
+	"external_ids": {"isrc": "USRC11200786"},
+	"id": "11dFghVXANMlKmJXsNCbNl",
+	"name": "Track",
+	"popularity": 71,
+	"preview_url": "https://p.scdn.co/mp3-preview/track",
+	"track_number": 1,
+	"type": "track",
+	"uri": "spotify:track:11dFghVXANMlKmJXsNCbNl",
+	"is_local": false
+}`
+
+func Test_decodeModels(t *testing.T) {
+	t.Run("artist", func(t *testing.T) {
+		var artist FullArtist
+		if err := json.Unmarshal([]byte(fullArtistJSON), &artist); err != nil {
+			t.Fatalf("error decoding artist: %v", err)
+		}
+		if artist.Id != "0TnOYISbd1XYRBk9myaseg" || artist.Followers.Total != 10384012 || artist.Followers.Href != nil ||
+			!reflect.DeepEqual(artist.Genres, []string{"dance pop", "pop"}) || artist.Popularity != 82 || artist.Images[0].Width != 640 {
+			t.Errorf("artist = %+v", artist)
+		}
+		want := Artist{
+			Id:           "0TnOYISbd1XYRBk9myaseg",
+			Name:         "Pitbull",
+			Uri:          "spotify:artist:0TnOYISbd1XYRBk9myaseg",
+			ExternalUrls: ExternalUrls{Spotify: "https://open.spotify.com/artist/0TnOYISbd1XYRBk9myaseg"},
+		}
+		if got := artist.Artist(); got != want {
+			t.Errorf("Artist() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("album", func(t *testing.T) {
+		var album FullAlbum
+		if err := json.Unmarshal([]byte(fullAlbumJSON), &album); err != nil {
+			t.Fatalf("error decoding album: %v", err)
+		}
+		if album.TotalTracks != 2 || len(album.AvailableMarkets) != 3 || album.Restrictions.Reason != "market" ||
+			album.Label != "Mr.305/Polo Grounds Music/RCA Records" || album.Popularity != 57 || album.ExternalIds.Upc != "886443671584" {
+			t.Errorf("album = %+v", album)
+		}
+		wantCopyrights := []Copyright{{Text: "(C) 2012 RCA Records", Type: CopyrightC}, {Text: "(P) 2012 RCA Records", Type: CopyrightP}}
+		if !reflect.DeepEqual(album.Copyrights, wantCopyrights) {
+			t.Errorf("copyrights = %+v", album.Copyrights)
+		}
+		if album.Tracks.Total != 2 || album.Tracks.Next == nil || album.Tracks.Previous != nil || len(album.Tracks.Items) != 1 {
+			t.Fatalf("tracks = %+v", album.Tracks)
+		}
+		track := album.Tracks.Items[0]
+		if track.DurationMs != 85400 || !track.Explicit || !track.IsPlayable || track.PreviewUrl != nil ||
+			track.LinkedFrom == nil || track.LinkedFrom.Id != "2gbA4cPhiIl4kyf0Oj4ghk" || track.Artists[0].Name != "Pitbull" {
+			t.Errorf("track = %+v", track)
+		}
+	})
+
+	t.Run("track", func(t *testing.T) {
+		var track FullTrack
+		if err := json.Unmarshal([]byte(fullTrackJSON), &track); err != nil {
+			t.Fatalf("error decoding track: %v", err)
+		}
+		if track.Id != "11dFghVXANMlKmJXsNCbNl" || track.Popularity != 71 || track.ExternalIds.Isrc != "USRC11200786" ||
+			track.PreviewUrl == nil || track.Album.Id != "1dUMRVQNHE3DYDhi6Ydh8o" || track.Album.TotalTracks != 1 {
+			t.Errorf("track = %+v", track)
+		}
+	})
+}
+
+func Test_SimplifiedAlbum_Album(t *testing.T) {
+	tests := []struct {
+		name      string
+		date      string
+		precision string
+		want      time.Time
+		wantErr   bool
+	}{
+		{name: "day", date: "2024-05-10", precision: "day", want: time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)},
+		{name: "month", date: "2012-11", precision: "month", want: time.Date(2012, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "year", date: "1999", precision: "year", want: time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "wrong date", date: "2024-13", precision: "month", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simplified := SimplifiedAlbum{
+				Id:                   "id",
+				TotalTracks:          3,
+				ReleaseDate:          tt.date,
+				ReleaseDatePrecision: tt.precision,
+				Images:               []Image{{Url: "large"}, {Url: "small"}},
+				Artists:              []SimplifiedArtist{{Id: "artist", Name: "Artist", Uri: "spotify:artist:artist"}},
+			}
+			album, err := simplified.Album()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Album() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !album.ReleaseDate.Equal(tt.want) || album.TotalTracks != 3 || album.ImageUrl != "large" ||
+				album.Artists[0].Uri != "spotify:artist:artist" {
+				t.Errorf("Album() = %+v", album)
+			}
+		})
+	}
+}
+
+func Test_GetAlbum(t *testing.T) {
+	token := OAuth2Token{AccessToken: "token", Expires: time.Now().Add(time.Hour)}
+	client := newClient(t, http.MethodGet, http.StatusOK, "/v1/albums/4aawyAB9vmqN3uQ7FjRGTy", fullAlbumJSON)
+
+	album, err := client.GetAlbum(&token, "4aawyAB9vmqN3uQ7FjRGTy", context.Background())
+	if err != nil {
+		t.Fatalf("GetAlbum() error = %v", err)
+	}
+	if album.Name != "Global Warming" || album.Label == "" || len(album.Tracks.Items) != 1 {
+		t.Errorf("GetAlbum() = %+v", album)
+	}
+
+	client = newClient(t, http.MethodGet, http.StatusNotFound, "/v1/albums/missing", `{"error": {"status": 404, "message": "Non existing id"}}`)
+	if _, err := client.GetAlbum(&token, "missing", context.Background()); err == nil {
+		t.Errorf("GetAlbum() error = nil for a missing album")
+	}
+}
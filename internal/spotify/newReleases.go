@@ -4,16 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
-
-	"TeleBotNotifications/internal/logger"
 )
 
-func (c *Client) GetNewReleasesArtist(artist Artist, token OAuth2Token, rangeStart, rangeEnd time.Time, ctx context.Context) ([]Album, error) {
+func (c *Client) GetNewReleasesArtist(artist Artist, token OAuth2Token, includeGroups []string, rangeStart, rangeEnd time.Time, ctx context.Context) ([]Album, error) {
 	var newAlbums []Album
-	lastAlbums, err := c.GetArtistAlbums(&token, &artist)
+	lastAlbums, err := c.GetArtistAlbums(&token, &artist, includeGroups, ctx)
 	if err != nil {
-		return nil, fmt.Errorf("error getting albums for artist %s(%s): %s", artist.Name, artist.Id, err)
+		return nil, fmt.Errorf("error getting albums for artist %s(%s): %w", artist.Name, artist.Id, err)
 	}
 	for _, album := range lastAlbums {
 		select {
@@ -21,6 +23,7 @@ func (c *Client) GetNewReleasesArtist(artist Artist, token OAuth2Token, rangeSta
 			return nil, context.Canceled
 		default:
 			if !rangeStart.After(album.ReleaseDate) && !rangeEnd.Before(album.ReleaseDate) {
+				album.Followed = []Artist{artist}
 				newAlbums = append(newAlbums, album)
 			}
 		}
@@ -28,12 +31,14 @@ func (c *Client) GetNewReleasesArtist(artist Artist, token OAuth2Token, rangeSta
 	return newAlbums, nil
 }
 
-func (c *Client) GetNewReleases(token OAuth2Token, rangeStart, rangeEnd time.Time, ctx context.Context) ([]Album, error) {
-	artists, err := c.GetFollowedArtists(&token)
+// GetNewReleases returns releases of followed artists in the groups and the
+// date range
+func (c *Client) GetNewReleases(token OAuth2Token, includeGroups []string, rangeStart, rangeEnd time.Time, ctx context.Context) ([]Album, error) {
+	artists, err := c.GetFollowedArtists(&token, ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error getting artists: %w", err)
 	}
-	logger.General.Println("Going to check", len(artists), "artists")
+	slog.InfoContext(ctx, "going to check artists", "artists", len(artists))
 
 	var newAlbums []Album
 	for _, artist := range artists {
@@ -41,11 +46,13 @@ func (c *Client) GetNewReleases(token OAuth2Token, rangeStart, rangeEnd time.Tim
 		case <-ctx.Done():
 			return nil, context.Canceled
 		default:
-			newArtistsAlbums, err := c.GetNewReleasesArtist(artist, token, rangeStart, rangeEnd, ctx)
+			artistsScannedTotal.Inc()
+			newArtistsAlbums, err := c.GetNewReleasesArtist(artist, token, includeGroups, rangeStart, rangeEnd, ctx)
 			if err != nil {
 				if errors.Is(err, context.Canceled) {
 					return nil, err
 				}
+				slog.WarnContext(ctx, "skipping artist", "artist_id", artist.Id, "error", err)
 				continue
 
 			}
@@ -55,5 +62,60 @@ func (c *Client) GetNewReleases(token OAuth2Token, rangeStart, rangeEnd time.Tim
 			time.Sleep(1 * time.Second)
 		}
 	}
-	return newAlbums, nil
+	return DedupeAlbums(newAlbums), nil
+}
+
+// Words telling apart explicit and clean versions of the same release
+var versionSuffix = regexp.MustCompile(`\s*[(\[]?\s*(explicit|clean)( version)?\s*[)\]]?$`)
+var nonWord = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// releaseKey identifies a release by the normalized title, the set of its
+// artists and the release date. Market-specific copies and explicit and
+// clean versions have different IDs but the same key
+func releaseKey(album Album) string {
+	title := versionSuffix.ReplaceAllString(strings.ToLower(album.Name), "")
+	title = strings.TrimSpace(nonWord.ReplaceAllString(title, " "))
+	artists := make([]string, 0, len(album.Artists))
+	for _, artist := range album.Artists {
+		artists = append(artists, artist.Id)
+	}
+	sort.Strings(artists)
+	return title + "|" + strings.Join(artists, ",") + "|" + album.ReleaseDate.Format("2006-01-02")
+}
+
+// DedupeAlbums merges releases found for several followed artists or listed
+// under several IDs. The first copy is kept with followed artists of all
+// copies
+func DedupeAlbums(albums []Album) []Album {
+	result := make([]Album, 0, len(albums))
+	index := make(map[string]int, len(albums))
+	for _, album := range albums {
+		i, ok := index["id:"+album.Id]
+		if !ok {
+			i, ok = index["key:"+releaseKey(album)]
+		}
+		if !ok {
+			i = len(result)
+			album.Followed = append([]Artist(nil), album.Followed...)
+			result = append(result, album)
+		} else {
+			for _, artist := range album.Followed {
+				if !hasArtist(result[i].Followed, artist.Id) {
+					result[i].Followed = append(result[i].Followed, artist)
+				}
+			}
+		}
+		index["id:"+album.Id] = i
+		index["key:"+releaseKey(album)] = i
+	}
+	return result
+}
+
+func hasArtist(artists []Artist, id string) bool {
+	for _, artist := range artists {
+		if artist.Id == id {
+			return true
+		}
+	}
+	return false
 }
@@ -26,12 +26,12 @@ func (c *Client) AddItemtoPlaybackQueue(token *OAuth2Token, uri, deviceId *strin
 	}
 	request.Header.Add("Authorization", "Bearer  "+token.AccessToken)
 	response, err := c.client.Do(request)
-	if err != nil || response.StatusCode != http.StatusNoContent {
-		explanation := &errorResponse{}
-		if err := json.NewDecoder(response.Body).Decode(explanation); err != nil {
-			return fmt.Errorf("http error %s, cant  decode response %s", response.Status, err)
-		}
-		return fmt.Errorf("http request fail: %s, %s", response.Status, explanation.Error.Message)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusNoContent {
+		return decodeErrorResponse(response)
 	}
 
 	return nil
@@ -71,12 +71,12 @@ func (c *Client) StartResumePlayback(token *OAuth2Token, contextURI, deviceId *s
 	request.Header.Add("Content-Type", "application/json")
 
 	response, err := c.client.Do(request)
-	if err != nil || response.StatusCode != http.StatusNoContent {
-		explanation := &errorResponse{}
-		if err := json.NewDecoder(response.Body).Decode(explanation); err != nil {
-			return fmt.Errorf("http error %s, cant  decode response %s", response.Status, err)
-		}
-		return fmt.Errorf("http request fail: %s, %s", response.Status, explanation.Error.Message)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusNoContent {
+		return decodeErrorResponse(response)
 	}
 
 	return nil
@@ -1,6 +1,8 @@
 package spotify
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -10,60 +12,131 @@ const authUrl = "https://accounts.spotify.com"
 const apiUrl = "https://api.spotify.com"
 
 type Album struct {
-	Id          string
-	Name        string
-	AlbumType   string
-	AlbumGroup  string
-	Url         string
-	Uri         string
-	ImageUrl    string
-	ReleaseDate time.Time
-	Artists     []Artist
+	Id          string    `json:"id"`
+	Name        string    `json:"name"`
+	AlbumType   string    `json:"album_type"`
+	AlbumGroup  string    `json:"album_group"`
+	Url         string    `json:"url"`
+	Uri         string    `json:"uri"`
+	ImageUrl    string    `json:"image_url"`
+	ReleaseDate time.Time `json:"release_date"`
+	Artists     []Artist  `json:"artists"`
+	// Day, month or year. ReleaseDate is the first day of the period
+	ReleaseDatePrecision string `json:"release_date_precision,omitempty"`
+	// Followed artists whose discography lists the release
+	Followed    []Artist `json:"followed,omitempty"`
+	TotalTracks int      `json:"total_tracks,omitempty"`
 }
 
-// TODO: create internal struct full matching spotify's
+// Album groups of artist discographies, the group tells how the artist takes
+// part in the release
+const (
+	GroupAlbum       = "album"
+	GroupSingle      = "single"
+	GroupCompilation = "compilation"
+	GroupAppearsOn   = "appears_on"
+)
+
+var AlbumGroups = []string{GroupAlbum, GroupSingle, GroupCompilation, GroupAppearsOn}
+
+// Groups requested when a user doesn't choose them
+var DefaultIncludeGroups = []string{GroupAlbum, GroupSingle}
+
+// Album types, a release of any group has one of them
+var AlbumTypes = []string{GroupAlbum, GroupSingle, GroupCompilation}
+
+// ReleasePeriod returns the first day of the release and the day after its
+// last day. Releases known to a month or a year span the whole period
+func (a *Album) ReleasePeriod() (time.Time, time.Time) {
+	switch a.ReleaseDatePrecision {
+	case "year":
+		return a.ReleaseDate, a.ReleaseDate.AddDate(1, 0, 0)
+	case "month":
+		return a.ReleaseDate, a.ReleaseDate.AddDate(0, 1, 0)
+	}
+	return a.ReleaseDate, a.ReleaseDate.AddDate(0, 0, 1)
+}
+
+// FormatReleaseDate shows the release date with its precision
+func (a *Album) FormatReleaseDate() string {
+	switch a.ReleaseDatePrecision {
+	case "year":
+		return a.ReleaseDate.Format("2006")
+	case "month":
+		return a.ReleaseDate.Format("January 2006")
+	}
+	return a.ReleaseDate.Format("2006-01-02")
+}
+
+// Artist is the part of an artist object kept with releases, see FullArtist
+// for the whole object
 type Artist struct {
-	Id   string `json:"id"`
-	Name string `json:"name"`
+	Id           string       `json:"id"`
+	Name         string       `json:"name"`
+	Uri          string       `json:"uri,omitempty"`
+	ExternalUrls ExternalUrls `json:"external_urls"`
+}
+
+// Url returns the Spotify page of the artist. Artists saved by older versions
+// have no external URLs, their page is built from the ID
+func (a Artist) Url() string {
+	if a.ExternalUrls.Spotify != "" {
+		return a.ExternalUrls.Spotify
+	}
+	return "https://open.spotify.com/artist/" + a.Id
 }
 
 type errorResponse struct {
 	Error struct {
 		Status  int    `json:"status"`
 		Message string `json:"message"`
+		Reason  string `json:"reason"`
 	} `json:"error"`
 }
 
-type ExternalUrls struct {
-	Spotify string `json:"spotify"`
+var ErrNoActiveDevice = errors.New("no active device")
+var ErrPremiumRequired = errors.New("spotify premium required")
+
+// APIError is returned when Spotify responds with an unexpected status code
+type APIError struct {
+	StatusCode int
+	Message    string
+	Reason     string
 }
 
-type SimplifiedArtist struct {
-	ExternalUrls ExternalUrls `json:"external_urls"`
-	Href         string       `json:"href"`
-	Id           string       `json:"id"`
-	Name         string       `json:"name"`
-	Type         string       `json:"type"`
-	Uri          string       `json:"uri"`
+func (e *APIError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("http request fail: %d, %s (%s)", e.StatusCode, e.Message, e.Reason)
+	}
+	return fmt.Sprintf("http request fail: %d, %s", e.StatusCode, e.Message)
 }
 
-type SimplifiedTrack struct {
-	Artists          []SimplifiedArtist
-	// AvailableMarkets []string     `json:"available_markets"`
-	DiscNumber       int          `json:"disc_number"`
-	DurationMs       int          `json:"duration_ms"`
-	Explicit         bool         `json:"explicit"`
-	ExternalUrls     ExternalUrls `json:"external_urls"`
-	Href             string       `json:"href"`
-	Id               string       `json:"id"`
-	IsPlayable       bool         `json:"is_playable"`
-	// LinkedFrom
-	// Restrictions
-	Name         string       `json:"name"`
-	TrackNumber int `json:"track_number"`
-	Type         string       `json:"type"`
-	Uri          string       `json:"uri"`
-	// IsLocal
+// Is matches player restriction reasons, see
+// https://developer.spotify.com/documentation/web-api/reference/get-information-about-the-users-current-playback
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNoActiveDevice:
+		return e.Reason == "NO_ACTIVE_DEVICE"
+	case ErrPremiumRequired:
+		return e.Reason == "PREMIUM_REQUIRED"
+	}
+	return false
+}
+
+func decodeErrorResponse(response *http.Response) error {
+	explanation := &errorResponse{}
+	if err := json.NewDecoder(response.Body).Decode(explanation); err != nil {
+		return fmt.Errorf("http error %s, cant  decode response %s", response.Status, err)
+	}
+	return &APIError{
+		StatusCode: response.StatusCode,
+		Message:    explanation.Error.Message,
+		Reason:     explanation.Error.Reason,
+	}
+}
+
+type ExternalUrls struct {
+	Spotify string `json:"spotify"`
 }
 
 func printRequestInfo(req *http.Request) {
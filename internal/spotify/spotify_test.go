@@ -1,6 +1,8 @@
 package spotify
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -460,8 +462,8 @@ func Test_getFollowedArtists(t *testing.T) {
 				`,
 				expected_request: "/v1/me/following",
 				expected_artists: []Artist{
-					{"1", "artist-1"},
-					{"2", "artist-2"},
+					{"1", "artist-1", "string", ExternalUrls{"string"}},
+					{"2", "artist-2", "string", ExternalUrls{"string"}},
 				},
 			},
 			wantErr: false,
@@ -473,7 +475,7 @@ func Test_getFollowedArtists(t *testing.T) {
 
 			client := newClient(t, http.MethodGet, tt.args.statusCode, tt.args.expected_request, tt.args.response)
 
-			artists, err := client.getFollowedArtists(&tt.args.current_token, 2)
+			artists, err := client.getFollowedArtists(&tt.args.current_token, 2, context.Background())
 
 			if err != nil {
 				if !tt.wantErr {
@@ -599,8 +601,8 @@ func Test_getArtistAlbums(t *testing.T) {
 				`,
 				expected_request: "/v1/artists/id/albums",
 				expected_result: []Album{
-					{"2up3OPMp9Tb4dAKM2er111", "name-1", "album", "compilation", "spotify_url", "spotify:album:1up", "image-url-1", time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), []Artist{{"1", "name-1"}}},
-					{"2up3OPMp9Tb4dAKM2erWXQ", "name-2", "compilation", "compilation", "another_spotify_url", "spotify:album:2up", "image-url-2", time.Date(1981, 12, 1, 0, 0, 0, 0, time.UTC), []Artist{{"2", "name-2"}}},
+					{"2up3OPMp9Tb4dAKM2er111", "name-1", "album", "compilation", "spotify_url", "spotify:album:1up", "image-url-1", time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), []Artist{{"1", "name-1", "string", ExternalUrls{"string"}}}, "year", nil, 9},
+					{"2up3OPMp9Tb4dAKM2erWXQ", "name-2", "compilation", "compilation", "another_spotify_url", "spotify:album:2up", "image-url-2", time.Date(1981, 12, 1, 0, 0, 0, 0, time.UTC), []Artist{{"2", "name-2", "string", ExternalUrls{"string"}}}, "day", nil, 9},
 				},
 			},
 			wantErr: false,
@@ -612,7 +614,7 @@ func Test_getArtistAlbums(t *testing.T) {
 
 			client := newClient(t, http.MethodGet, tt.args.statusCode, tt.args.expected_request, tt.args.response)
 
-			albums, err := client.getArtistAlbums(&tt.args.current_token, "id", "", 2)
+			albums, err := client.getArtistAlbums(&tt.args.current_token, "id", "", 2, context.Background())
 
 			if err != nil {
 				if !tt.wantErr {
@@ -646,7 +648,9 @@ func compareAlbums(a1, a2 Album) bool {
 		a1.AlbumType != a2.AlbumType ||
 		a1.Url != a2.Url ||
 		a1.ImageUrl != a2.ImageUrl ||
-		a1.ReleaseDate != a2.ReleaseDate {
+		a1.ReleaseDate != a2.ReleaseDate ||
+		a1.ReleaseDatePrecision != a2.ReleaseDatePrecision ||
+		a1.TotalTracks != a2.TotalTracks {
 		return false
 	}
 	if len(a1.Artists) != len(a2.Artists) {
@@ -659,3 +663,163 @@ func compareAlbums(a1, a2 Album) bool {
 	}
 	return true
 }
+
+func Test_StartResumePlaybackErrors(t *testing.T) {
+	type args struct {
+		statusCode int
+		response   string
+		expected   error
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "OK",
+			args: args{
+				statusCode: http.StatusNoContent,
+				response:   "",
+			},
+			wantErr: false,
+		},
+		{
+			name: "NoActiveDevice",
+			args: args{
+				statusCode: http.StatusNotFound,
+				response:   `{"error": {"status": 404, "message": "Player command failed: No active device found", "reason": "NO_ACTIVE_DEVICE"}}`,
+				expected:   ErrNoActiveDevice,
+			},
+			wantErr: true,
+		},
+		{
+			name: "PremiumRequired",
+			args: args{
+				statusCode: http.StatusForbidden,
+				response:   `{"error": {"status": 403, "message": "Player command failed: Premium required", "reason": "PREMIUM_REQUIRED"}}`,
+				expected:   ErrPremiumRequired,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newClient(t, http.MethodPut, tt.args.statusCode, "/v1/me/player/play", tt.args.response)
+			token := OAuth2Token{AccessToken: "sample-access-token", Expires: time.Now().Add(time.Hour)}
+			uri := "spotify:album:1up"
+
+			err := client.StartResumePlayback(&token, &uri, nil)
+			if err == nil {
+				if tt.wantErr {
+					t.Error("Error expected")
+				}
+				return
+			}
+			if !tt.wantErr {
+				t.Errorf("Unexpected error: %v", err)
+			} else if !errors.Is(err, tt.args.expected) {
+				t.Errorf("Expected %v, got %v", tt.args.expected, err)
+			}
+		})
+	}
+}
+
+func Test_endpoint(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/v1/me/following", "/v1/me/following"},
+		{"/v1/artists/0TnOYISbd1XYRBk9myaseg/albums", "/v1/artists/{id}/albums"},
+		{"/v1/albums/4aawyAB9vmqN3uQ7FjRGTy/tracks", "/v1/albums/{id}/tracks"},
+		{"/v1/albums/4aawyAB9vmqN3uQ7FjRGTy", "/v1/albums/{id}"},
+	}
+	for _, tt := range tests {
+		if got := endpoint(tt.path); got != tt.want {
+			t.Errorf("endpoint(%s): expected %s, got %s", tt.path, tt.want, got)
+		}
+	}
+}
+
+func Test_instrumentedTransportRetry(t *testing.T) {
+	calls := 0
+	transport := &instrumentedTransport{next: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		if body, _ := io.ReadAll(r.Body); string(body) != "body" {
+			t.Errorf("Expected the body in call %d, got %q", calls, body)
+		}
+		if calls == 1 {
+			return &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"Retry-After": {"0"}},
+				Body:       io.NopCloser(strings.NewReader("")),
+			}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})}
+
+	request, _ := http.NewRequest(http.MethodPut, "https://api.spotify.com/v1/me/player/play", strings.NewReader("body"))
+	body := request.Body
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK || calls != 2 {
+		t.Errorf("Expected status 200 after 2 calls, got %d after %d", response.StatusCode, calls)
+	}
+	if request.Body != body {
+		t.Errorf("RoundTrip changed the body of the request")
+	}
+}
+
+func Test_instrumentedTransportCanceled(t *testing.T) {
+	transport := &instrumentedTransport{next: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusTooManyRequests,
+			Header:     http.Header{"Retry-After": {"30"}},
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.spotify.com/v1/me/following", nil)
+	start := time.Now()
+	if _, err := transport.RoundTrip(request); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context error, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("RoundTrip waited for Retry-After of a canceled request")
+	}
+}
+
+func Test_DedupeAlbums(t *testing.T) {
+	date := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	a, b, c := Artist{Id: "a", Name: "A"}, Artist{Id: "b", Name: "B"}, Artist{Id: "c", Name: "C"}
+	albums := []Album{
+		{Id: "1", Name: "Split", ReleaseDate: date, Artists: []Artist{a, b}, Followed: []Artist{a}},
+		{Id: "2", Name: "Solo", ReleaseDate: date, Artists: []Artist{c}, Followed: []Artist{c}},
+		{Id: "1", Name: "Split", ReleaseDate: date, Artists: []Artist{a, b}, Followed: []Artist{b}},
+		{Id: "3", Name: "Solo (Clean)", ReleaseDate: date, Artists: []Artist{c}, Followed: []Artist{c}},
+		{Id: "4", Name: "split", ReleaseDate: date, Artists: []Artist{b, a}, Followed: []Artist{b}},
+		{Id: "5", Name: "Solo", ReleaseDate: date.AddDate(0, 0, 1), Artists: []Artist{c}, Followed: []Artist{c}},
+	}
+
+	got := DedupeAlbums(albums)
+	var ids, followed []string
+	for _, album := range got {
+		ids = append(ids, album.Id)
+		var names []string
+		for _, artist := range album.Followed {
+			names = append(names, artist.Name)
+		}
+		followed = append(followed, strings.Join(names, "+"))
+	}
+	if fmt.Sprint(ids) != "[1 2 5]" || fmt.Sprint(followed) != "[A+B C C]" {
+		t.Errorf("DedupeAlbums() ids = %v, followed = %v", ids, followed)
+	}
+	if len(albums[0].Followed) != 1 {
+		t.Errorf("DedupeAlbums() changed the input: %v", albums[0].Followed)
+	}
+}
@@ -1,6 +1,7 @@
 package spotify
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/url"
@@ -9,13 +10,10 @@ import (
 )
 
 type FollowedArtistsResponse struct {
-	Artists struct {
-		Next  *string  `json:"next"`
-		Items []Artist `json:"items"`
-	} `json:"artists"`
+	Artists ArtistCursorPage `json:"artists"`
 }
 
-func (c *Client) getFollowedArtists(token *OAuth2Token, request_limit uint) ([]Artist, error) {
+func (c *Client) getFollowedArtists(token *OAuth2Token, request_limit uint, ctx context.Context) ([]Artist, error) {
 	getRequestUrl := func(limit uint) (*string, error) {
 		resource := "/v1/me/following"
 		params := url.Values{}
@@ -48,14 +46,17 @@ func (c *Client) getFollowedArtists(token *OAuth2Token, request_limit uint) ([]A
 			token = refreshed_token
 		}
 
-		request, err := http.NewRequest(http.MethodGet, *requestUrl, nil)
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, *requestUrl, nil)
 		if err != nil {
 			return nil, err
 		}
 		request.Header.Add("Authorization", "Bearer  "+token.AccessToken)
 
 		response, err := c.client.Do(request)
-		if err != nil || response.StatusCode != http.StatusOK {
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode != http.StatusOK {
 			explanation := &errorResponse{}
 			if err := json.NewDecoder(response.Body).Decode(explanation); err != nil {
 				return nil, fmt.Errorf("http error %s, cant  decode response %s", response.Status, err)
@@ -68,7 +69,9 @@ func (c *Client) getFollowedArtists(token *OAuth2Token, request_limit uint) ([]A
 		if err != nil {
 			return nil, err
 		}
-		artists = append(artists, artists_group.Artists.Items...)
+		for _, artist := range artists_group.Artists.Items {
+			artists = append(artists, artist.Artist())
+		}
 		requestUrl = artists_group.Artists.Next
 	}
 
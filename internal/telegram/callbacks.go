@@ -1,9 +1,7 @@
 package telegram
 
 import (
-	"fmt"
-	"net/http"
-	"net/url"
+	"context"
 	"strings"
 )
 
@@ -12,8 +10,14 @@ type callback struct {
 	Handler CallbackHandler
 }
 
-// TODO: type CallbackHandler func(Callback) error
-type CallbackHandler func(Callback)
+// CallbackAnswer is shown to the user as a notification at the top of the chat
+// screen or as an alert
+type CallbackAnswer struct {
+	Text      string
+	ShowAlert bool
+}
+
+type CallbackHandler func(Callback) (CallbackAnswer, error)
 
 func (b *Bot) AddCallback(keyword string, handler CallbackHandler) {
 	b.callbacks = append(b.callbacks, callback{
@@ -24,8 +28,10 @@ func (b *Bot) AddCallback(keyword string, handler CallbackHandler) {
 
 type Callback struct {
 	UserId int
-	ChatId string
-	Data   string
+	ChatId int
+	// Message with the pressed button, empty for inline messages
+	MessageId int
+	Data      string
 }
 
 func (b *Bot) handleCallback(c *callbackQuery) {
@@ -34,30 +40,55 @@ func (b *Bot) handleCallback(c *callbackQuery) {
 	}
 	for _, callback := range b.callbacks {
 		if strings.HasPrefix(*c.Data, callback.Keyword) {
-			// TODO: error checks
-			callback.Handler(Callback{
+			received := Callback{
 				UserId: c.From.Id,
-				ChatId: c.ChatInstance,
 				Data:   strings.TrimSpace(strings.TrimPrefix(*c.Data, callback.Keyword)),
+			}
+			if c.Message != nil {
+				received.ChatId = c.Message.Chat.Id
+				received.MessageId = c.Message.MessageId
+			}
+
+			var answer CallbackAnswer
+			err := b.wrap(func(Request) error {
+				var err error
+				answer, err = callback.Handler(received)
+				return err
+			})(Request{
+				UserId:   c.From.Id,
+				ChatId:   received.ChatId,
+				Keyword:  callback.Keyword,
+				Callback: true,
 			})
-			b.answerCallbackQuery(c.Id)
+			if err != nil {
+				answer = CallbackAnswer{
+					Text:      errorText(err),
+					ShowAlert: true,
+				}
+			}
+			b.answerCallbackQuery(c.Id, answer)
 			return
 		}
 	}
 }
 
-func (b *Bot) answerCallbackQuery(queryId string) error {
-	resourse := fmt.Sprintf("/bot%s/answerCallbackQuery", b.token)
-	params := url.Values{
-		"callback_query_id": {queryId},
-	}
-	u, _ := url.ParseRequestURI(apiURL)
-	u.Path = resourse
-	u.RawQuery = params.Encode()
-	requestURL := u.String()
-	_, err := http.Get(requestURL)
-	if err != nil {
-		return fmt.Errorf("sending request failed with err: %s", err)
+// Telegram cuts answer text to 200 characters
+const maxCallbackAnswerLength = 200
+
+type answerCallbackQueryParams struct {
+	CallbackQueryId string `json:"callback_query_id"`
+	Text            string `json:"text,omitempty"`
+	ShowAlert       bool   `json:"show_alert,omitempty"`
+}
+
+func (b *Bot) answerCallbackQuery(queryId string, answer CallbackAnswer) error {
+	text := []rune(answer.Text)
+	if len(text) > maxCallbackAnswerLength {
+		text = append(text[:maxCallbackAnswerLength-1], '…')
 	}
-	return nil
+	return b.call(context.Background(), "answerCallbackQuery", answerCallbackQueryParams{
+		CallbackQueryId: queryId,
+		Text:            string(text),
+		ShowAlert:       answer.ShowAlert,
+	}, nil)
 }
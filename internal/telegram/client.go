@@ -0,0 +1,125 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// APIError is an unsuccessful Bot API response
+type APIError struct {
+	Code            int
+	Description     string
+	RetryAfter      time.Duration
+	MigrateToChatId int
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("telegram api error %d: %s", e.Code, e.Description)
+}
+
+// temporary reports whether the request may succeed if repeated later
+func temporary(err error) bool {
+	var apiError *APIError
+	if errors.As(err, &apiError) {
+		return apiError.Code == http.StatusTooManyRequests || apiError.Code >= http.StatusInternalServerError
+	}
+	var netError net.Error
+	return errors.As(err, &netError)
+}
+
+type responseParameters struct {
+	MigrateToChatId int `json:"migrate_to_chat_id"`
+	RetryAfter      int `json:"retry_after"`
+}
+
+// https://core.telegram.org/bots/api#making-requests
+type apiResponse struct {
+	Ok          bool                `json:"ok"`
+	Result      json.RawMessage     `json:"result"`
+	ErrorCode   int                 `json:"error_code"`
+	Description string              `json:"description"`
+	Parameters  *responseParameters `json:"parameters"`
+}
+
+func decodeResponse(response *http.Response, result interface{}) error {
+	body := &apiResponse{}
+	if err := json.NewDecoder(response.Body).Decode(body); err != nil {
+		if response.StatusCode != http.StatusOK {
+			return &APIError{Code: response.StatusCode, Description: response.Status}
+		}
+		return fmt.Errorf("decoding response failed with error: %w", err)
+	}
+
+	if !body.Ok {
+		apiError := &APIError{Code: body.ErrorCode, Description: body.Description}
+		if apiError.Code == 0 {
+			apiError.Code = response.StatusCode
+		}
+		if body.Parameters != nil {
+			apiError.RetryAfter = time.Duration(body.Parameters.RetryAfter) * time.Second
+			apiError.MigrateToChatId = body.Parameters.MigrateToChatId
+		}
+		return apiError
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body.Result, result); err != nil {
+		return fmt.Errorf("decoding result failed with error: %w", err)
+	}
+	return nil
+}
+
+// call posts params as JSON to the Bot API method and decodes the result into
+// result, which may be nil
+func call(ctx context.Context, client *http.Client, token, method string, params, result interface{}) (err error) {
+	start := time.Now()
+	defer func() {
+		apiRequestDuration.Observe(time.Since(start).Seconds(), method)
+		apiRequestsTotal.Inc(method, resultLabel(err))
+	}()
+
+	u, err := url.ParseRequestURI(apiURL)
+	if err != nil {
+		return err
+	}
+	u.Path = fmt.Sprintf("/bot%s/%s", token, method)
+
+	payload, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("creating request failed with err: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return fmt.Errorf("request was canceled: %w", err)
+		}
+		// Error of the client contains the URL with the token
+		var urlError *url.Error
+		if errors.As(err, &urlError) {
+			err = urlError.Err
+		}
+		return fmt.Errorf("%s request failed with err: %w", method, err)
+	}
+	defer response.Body.Close()
+
+	return decodeResponse(response, result)
+}
+
+func (b *Bot) call(ctx context.Context, method string, params, result interface{}) error {
+	return call(ctx, b.http_client, b.token, method, params, result)
+}
@@ -1,12 +1,11 @@
 package telegram
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
-	"net/url"
 	"strings"
+
+	"TeleBotNotifications/internal/telegram/format"
 )
 
 type command struct {
@@ -15,8 +14,7 @@ type command struct {
 	Handler     CommandHandler `json:"-"`
 }
 
-// TODO: type CommandHandler func(ReceivedMessage) error
-type CommandHandler func(ReceivedMessage)
+type CommandHandler func(ReceivedMessage) error
 
 func (b *Bot) AddCommand(keyword string, description string, handler CommandHandler) {
 	b.commands = append(b.commands, command{
@@ -27,42 +25,13 @@ func (b *Bot) AddCommand(keyword string, description string, handler CommandHand
 }
 
 func (b *Bot) UpdateCommands() error {
-	resource := fmt.Sprintf("/bot%s/setMyCommands", b.token)
-	u, err := url.ParseRequestURI(apiURL)
-	if err != nil {
-		return err
-	}
-	u.Path = resource
-	requestUrl := u.String()
-
-	// Define the payload data as a Go struct.
-	data := map[string][]command{
+	params := map[string][]command{
 		"commands": b.commands,
 	}
-	payload, err := json.Marshal(data)
+	err := b.call(context.Background(), "setMyCommands", params, nil)
 	if err != nil {
-		return fmt.Errorf("error marshaling JSON: %i", err)
+		return fmt.Errorf("setting commands failed with err: %w", err)
 	}
-
-	// Create a request with the payload.
-	request, err := http.NewRequest(http.MethodPost, requestUrl, bytes.NewBuffer(payload))
-	if err != nil {
-		return fmt.Errorf("error creating request: %i", err)
-	}
-	request.Header.Set("Content-Type", "application/json")
-
-	// Send the request.
-	response, err := b.http_client.Do(request)
-	if err != nil {
-		return fmt.Errorf("error sending request: %i", err)
-	}
-	defer response.Body.Close()
-
-	// Check the response.
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("request failed with status: %s", response.Status)
-	}
-
 	return nil
 }
 
@@ -70,16 +39,56 @@ type ReceivedMessage struct {
 	UserId int
 	ChatId int
 	Text   string
+	// Shared location, only for the location handler
+	Location *Location
+}
+
+// OnLocation sets the handler of shared locations
+func (b *Bot) OnLocation(handler CommandHandler) {
+	b.locationHandler = handler
+}
+
+func (b *Bot) handleLocation(m *Message) {
+	received := ReceivedMessage{
+		UserId:   m.userId(),
+		ChatId:   m.Chat.Id,
+		Location: m.Location,
+	}
+	err := b.wrap(func(Request) error {
+		return b.locationHandler(received)
+	})(Request{
+		UserId:  m.userId(),
+		ChatId:  m.Chat.Id,
+		Keyword: "location",
+	})
+	if err != nil {
+		reply := FormattedMessage(format.New(format.HTML).Text("⚠️ ").Italic(errorText(err)))
+		reply.ChatId = m.Chat.Id
+		b.SendMessage(reply)
+	}
 }
 
-func (b *Bot) handleCommand(m *message) {
+func (b *Bot) handleCommand(m *Message) {
 	for j := 0; j < len(b.commands); j++ {
 		if strings.HasPrefix(m.Text, b.commands[j].Keyword) {
-			b.commands[j].Handler(ReceivedMessage{
-				UserId: m.From.Id,
+			handler := b.commands[j].Handler
+			received := ReceivedMessage{
+				UserId: m.userId(),
 				ChatId: m.Chat.Id,
 				Text:   strings.TrimSpace(strings.TrimPrefix(m.Text, b.commands[j].Keyword)),
+			}
+			err := b.wrap(func(Request) error {
+				return handler(received)
+			})(Request{
+				UserId:  m.userId(),
+				ChatId:  m.Chat.Id,
+				Keyword: b.commands[j].Keyword,
 			})
+			if err != nil {
+				reply := FormattedMessage(format.New(format.HTML).Text("⚠️ ").Italic(errorText(err)))
+				reply.ChatId = m.Chat.Id
+				b.SendMessage(reply)
+			}
 			return
 		}
 	}
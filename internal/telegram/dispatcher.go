@@ -0,0 +1,99 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+)
+
+const defaultWorkers = 4
+const workerQueueSize = 64
+
+var errDispatcherStopped = errors.New("update dispatcher is stopped")
+
+// dispatcher runs update handlers on a fixed number of workers. Updates from
+// the same chat always go to the same worker, so they are handled in order,
+// while different chats are handled in parallel
+type dispatcher struct {
+	queues []chan func()
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newDispatcher(workers int) *dispatcher {
+	if workers < 1 {
+		workers = defaultWorkers
+	}
+	d := &dispatcher{queues: make([]chan func(), workers)}
+	for i := range d.queues {
+		d.queues[i] = make(chan func(), workerQueueSize)
+	}
+	return d
+}
+
+func (d *dispatcher) start(wg *sync.WaitGroup) {
+	for _, queue := range d.queues {
+		wg.Add(1)
+		go func(queue chan func()) {
+			defer wg.Done()
+			for job := range queue {
+				run(job)
+			}
+		}(queue)
+	}
+}
+
+func run(job func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			slog.Error("panic in update handler", "panic", p, "stack", string(debug.Stack()))
+		}
+	}()
+	job()
+}
+
+// dispatch queues the job for the worker responsible for the chat. Jobs
+// dispatched after stop are refused
+func (d *dispatcher) dispatch(ctx context.Context, chatId int, job func()) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return errDispatcherStopped
+	}
+
+	index := chatId % len(d.queues)
+	if index < 0 {
+		index = -index
+	}
+	select {
+	case d.queues[index] <- job:
+		return nil
+	case <-ctx.Done():
+		return context.Canceled
+	}
+}
+
+// stop closes the queues. Workers finish already queued jobs before exiting
+func (d *dispatcher) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	d.closed = true
+	for _, queue := range d.queues {
+		close(queue)
+	}
+}
+
+// StartDispatcher launches update handling workers. They are added to wg and
+// finish after StopDispatcher once every queued update is handled
+func (b *Bot) StartDispatcher(wg *sync.WaitGroup) {
+	b.dispatcher.start(wg)
+}
+
+func (b *Bot) StopDispatcher() {
+	b.dispatcher.stop()
+}
@@ -0,0 +1,92 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Document is a file sent as an attachment
+// https://core.telegram.org/bots/api#senddocument
+type Document struct {
+	ChatId    int
+	FileName  string
+	Content   []byte
+	Caption   string
+	ParseMode *string
+}
+
+// SendDocument queues the document with messages and waits until it is
+// delivered
+func (b *Bot) SendDocument(document Document) (*Message, error) {
+	if document.ChatId == 0 {
+		document.ChatId = b.ChatId
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("chat_id", strconv.Itoa(document.ChatId))
+	if document.Caption != "" {
+		writer.WriteField("caption", document.Caption)
+	}
+	if document.ParseMode != nil {
+		writer.WriteField("parse_mode", *document.ParseMode)
+	}
+	file, err := writer.CreateFormFile("document", document.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("error creating form file: %w", err)
+	}
+	if _, err = file.Write(document.Content); err != nil {
+		return nil, fmt.Errorf("error writing form file: %w", err)
+	}
+	if err = writer.Close(); err != nil {
+		return nil, fmt.Errorf("error closing form: %w", err)
+	}
+
+	contentType := writer.FormDataContentType()
+	result := <-b.sender.enqueueFunc(document.ChatId, func(ctx context.Context) (*Message, error) {
+		return sendDocument(ctx, b.http_client, b.token, contentType, body.Bytes())
+	})
+	return result.Message, result.Err
+}
+
+// sendDocument posts the multipart form, the form is read anew in every attempt
+func sendDocument(ctx context.Context, client *http.Client, token, contentType string, form []byte) (*Message, error) {
+	u, err := url.ParseRequestURI(apiURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = fmt.Sprintf("/bot%s/sendDocument", token)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(form))
+	if err != nil {
+		return nil, fmt.Errorf("creating request failed with err: %w", err)
+	}
+	request.Header.Set("Content-Type", contentType)
+
+	start := time.Now()
+	response, err := client.Do(request)
+	apiRequestDuration.Observe(time.Since(start).Seconds(), "sendDocument")
+	if err != nil {
+		apiRequestsTotal.Inc("sendDocument", resultLabel(err))
+		var urlError *url.Error
+		if errors.As(err, &urlError) {
+			err = urlError.Err
+		}
+		return nil, fmt.Errorf("sendDocument request failed with err: %w", err)
+	}
+	defer response.Body.Close()
+
+	sent := &Message{}
+	err = decodeResponse(response, sent)
+	apiRequestsTotal.Inc("sendDocument", resultLabel(err))
+	if err != nil {
+		return nil, err
+	}
+	return sent, nil
+}
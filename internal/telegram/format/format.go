@@ -0,0 +1,177 @@
+// Package format builds message texts for Telegram parse modes, escaping
+// user provided strings as each mode requires
+// https://core.telegram.org/bots/api#formatting-options
+package format
+
+import (
+	"strings"
+)
+
+type Mode string
+
+const (
+	MarkdownV2 Mode = "MarkdownV2"
+	HTML       Mode = "HTML"
+)
+
+// Characters which must be escaped anywhere outside of code entities
+const markdownV2Special = "_*[]()~`>#+-=|{}.!\\"
+
+func EscapeMarkdownV2(text string) string {
+	return escape(text, markdownV2Special)
+}
+
+// Inside pre and code entities only ` and \ are escaped
+func escapeMarkdownV2Code(text string) string {
+	return escape(text, "`\\")
+}
+
+// Inside the link part of an inline link only ) and \ are escaped
+func escapeMarkdownV2Link(url string) string {
+	return escape(url, ")\\")
+}
+
+func escape(text, special string) string {
+	var builder strings.Builder
+	builder.Grow(len(text))
+	for _, ch := range text {
+		if strings.ContainsRune(special, ch) {
+			builder.WriteByte('\\')
+		}
+		builder.WriteRune(ch)
+	}
+	return builder.String()
+}
+
+var htmlReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+
+func EscapeHTML(text string) string {
+	return htmlReplacer.Replace(text)
+}
+
+func Escape(mode Mode, text string) string {
+	if mode == HTML {
+		return EscapeHTML(text)
+	}
+	return EscapeMarkdownV2(text)
+}
+
+// Builder collects formatted segments. Every segment is a complete entity, so
+// a text can be split between segments without breaking the markup
+type Builder struct {
+	mode     Mode
+	segments []segment
+}
+
+type segment struct {
+	// text without markup
+	plain string
+	open  string
+	close string
+	// escape applied to the plain text
+	escape func(string) string
+}
+
+func (s segment) String() string {
+	return s.open + s.escape(s.plain) + s.close
+}
+
+func New(mode Mode) *Builder {
+	return &Builder{mode: mode}
+}
+
+func (b *Builder) Mode() Mode {
+	return b.mode
+}
+
+func (b *Builder) add(text, markdownV2, html string) *Builder {
+	if b.mode == HTML {
+		return b.wrap(text, "<"+html+">", "</"+html+">", EscapeHTML)
+	}
+	return b.wrap(text, markdownV2, markdownV2, EscapeMarkdownV2)
+}
+
+func (b *Builder) wrap(text, open, close string, escape func(string) string) *Builder {
+	b.segments = append(b.segments, segment{plain: text, open: open, close: close, escape: escape})
+	return b
+}
+
+// Text adds plain text
+func (b *Builder) Text(text string) *Builder {
+	if b.mode == HTML {
+		return b.wrap(text, "", "", EscapeHTML)
+	}
+	return b.wrap(text, "", "", EscapeMarkdownV2)
+}
+
+// Line adds plain text followed by a line break
+func (b *Builder) Line(text string) *Builder {
+	return b.Text(text + "\n")
+}
+
+func (b *Builder) Bold(text string) *Builder {
+	return b.add(text, "*", "b")
+}
+
+func (b *Builder) Italic(text string) *Builder {
+	return b.add(text, "_", "i")
+}
+
+func (b *Builder) Underline(text string) *Builder {
+	return b.add(text, "__", "u")
+}
+
+func (b *Builder) Strikethrough(text string) *Builder {
+	return b.add(text, "~", "s")
+}
+
+func (b *Builder) Spoiler(text string) *Builder {
+	return b.add(text, "||", "tg-spoiler")
+}
+
+func (b *Builder) Code(text string) *Builder {
+	if b.mode == HTML {
+		return b.wrap(text, "<code>", "</code>", EscapeHTML)
+	}
+	return b.wrap(text, "`", "`", escapeMarkdownV2Code)
+}
+
+// Pre adds a preformatted block, language may be empty
+func (b *Builder) Pre(text, language string) *Builder {
+	if b.mode == HTML {
+		if language == "" {
+			return b.wrap(text, "<pre>", "</pre>", EscapeHTML)
+		}
+		return b.wrap(text, "<pre><code class=\"language-"+EscapeHTML(language)+"\">", "</code></pre>", EscapeHTML)
+	}
+	return b.wrap(text, "```"+language+"\n", "\n```", escapeMarkdownV2Code)
+}
+
+func (b *Builder) Link(text, url string) *Builder {
+	if b.mode == HTML {
+		return b.wrap(text, "<a href=\""+EscapeHTML(url)+"\">", "</a>", EscapeHTML)
+	}
+	return b.wrap(text, "[", "]("+escapeMarkdownV2Link(url)+")", EscapeMarkdownV2)
+}
+
+// BoldLink adds a link with bold text
+func (b *Builder) BoldLink(text, url string) *Builder {
+	if b.mode == HTML {
+		return b.wrap(text, "<b><a href=\""+EscapeHTML(url)+"\">", "</a></b>", EscapeHTML)
+	}
+	return b.wrap(text, "*[", "]("+escapeMarkdownV2Link(url)+")*", EscapeMarkdownV2)
+}
+
+// Append adds every segment of another builder with the same mode
+func (b *Builder) Append(other *Builder) *Builder {
+	b.segments = append(b.segments, other.segments...)
+	return b
+}
+
+func (b *Builder) String() string {
+	var builder strings.Builder
+	for _, s := range b.segments {
+		builder.WriteString(s.String())
+	}
+	return builder.String()
+}
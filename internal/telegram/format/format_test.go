@@ -0,0 +1,187 @@
+package format
+
+import (
+	"testing"
+)
+
+func Test_Escape(t *testing.T) {
+	tests := []struct {
+		name string
+		mode Mode
+		text string
+		want string
+	}{
+		{
+			name: "MarkdownV2",
+			mode: MarkdownV2,
+			text: `Title (Deluxe) [2023] - v1.0! \o/ *_~|#+={}>`,
+			want: `Title \(Deluxe\) \[2023\] \- v1\.0\! \\o/ \*\_\~\|\#\+\=\{\}\>`,
+		},
+		{
+			name: "HTML",
+			mode: HTML,
+			text: `<b>Rock & "Roll"</b>`,
+			want: `&lt;b&gt;Rock &amp; &quot;Roll&quot;&lt;/b&gt;`,
+		},
+		{
+			name: "Unicode",
+			mode: MarkdownV2,
+			text: "Сплин · 東京",
+			want: "Сплин · 東京",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Escape(tt.mode, tt.text); got != tt.want {
+				t.Errorf("\nexpected\t%s\ngot\t\t%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_Builder(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(*Builder) *Builder
+		mode  Mode
+		want  string
+	}{
+		{
+			name: "MarkdownV2Entities",
+			mode: MarkdownV2,
+			build: func(b *Builder) *Builder {
+				return b.Bold("a*b").Text(" ").Italic("c_d").Text(" ").Spoiler("e|f").Text(" ").Strikethrough("g").Text(" ").Underline("h")
+			},
+			want: `*a\*b* _c\_d_ ||e\|f|| ~g~ __h__`,
+		},
+		{
+			name: "MarkdownV2Code",
+			mode: MarkdownV2,
+			build: func(b *Builder) *Builder {
+				return b.Code("a_b`c\\").Pre("x := [1]", "go")
+			},
+			want: "`a_b\\`c\\\\`" + "```go\nx := [1]\n```",
+		},
+		{
+			name: "MarkdownV2Link",
+			mode: MarkdownV2,
+			build: func(b *Builder) *Builder {
+				return b.Link("Song (Remix)", "https://example.com/a_(b)")
+			},
+			want: `[Song \(Remix\)](https://example.com/a_(b\))`,
+		},
+		{
+			name: "MarkdownV2BoldLink",
+			mode: MarkdownV2,
+			build: func(b *Builder) *Builder {
+				return b.BoldLink("A*B", "https://example.com/a")
+			},
+			want: `*[A\*B](https://example.com/a)*`,
+		},
+		{
+			name: "HTMLEntities",
+			mode: HTML,
+			build: func(b *Builder) *Builder {
+				return b.Bold("a<b").Italic("c").Underline("d").Strikethrough("e").Spoiler("f").Code("g&h").Pre("i", "")
+			},
+			want: `<b>a&lt;b</b><i>c</i><u>d</u><s>e</s><tg-spoiler>f</tg-spoiler><code>g&amp;h</code><pre>i</pre>`,
+		},
+		{
+			name: "HTMLLink",
+			mode: HTML,
+			build: func(b *Builder) *Builder {
+				return b.Link("Rock & Roll", `https://example.com/?a=1&b="2"`)
+			},
+			want: `<a href="https://example.com/?a=1&amp;b=&quot;2&quot;">Rock &amp; Roll</a>`,
+		},
+		{
+			name: "HTMLBoldLink",
+			mode: HTML,
+			build: func(b *Builder) *Builder {
+				return b.BoldLink("A&B", "https://example.com/a")
+			},
+			want: `<b><a href="https://example.com/a">A&amp;B</a></b>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.build(New(tt.mode)).String(); got != tt.want {
+				t.Errorf("\nexpected\t%s\ngot\t\t%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_Split(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  Mode
+		build func(*Builder) *Builder
+		limit int
+		want  []string
+	}{
+		{
+			name: "Fits",
+			mode: MarkdownV2,
+			build: func(b *Builder) *Builder {
+				return b.Bold("title").Text(" · artist")
+			},
+			limit: 100,
+			want:  []string{`*title* · artist`},
+		},
+		{
+			name: "BetweenEntities",
+			mode: MarkdownV2,
+			build: func(b *Builder) *Builder {
+				return b.Bold("first").Bold("second").Bold("third")
+			},
+			limit: 16,
+			want:  []string{`*first**second*`, `*third*`},
+		},
+		{
+			name: "LongEntityOnLines",
+			mode: HTML,
+			build: func(b *Builder) *Builder {
+				return b.Pre("line 1\nline 2\nline 3", "")
+			},
+			limit: 25,
+			want:  []string{"<pre>line 1\nline 2\n</pre>", "<pre>line 3</pre>"},
+		},
+		{
+			name: "EscapedCharacters",
+			mode: MarkdownV2,
+			build: func(b *Builder) *Builder {
+				return b.Text("a.b.c.d")
+			},
+			limit: 5,
+			want:  []string{`a\.b`, `\.c\.`, `d`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.build(New(tt.mode)).Split(tt.limit)
+			if len(got) != len(tt.want) {
+				t.Fatalf("\nexpected\t%q\ngot\t\t%q", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] || Length(got[i]) > tt.limit {
+					t.Fatalf("\nexpected\t%q\ngot\t\t%q", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func Test_SplitText(t *testing.T) {
+	got := SplitText("one two three", 8)
+	want := []string{"one two ", "three"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("\nexpected\t%q\ngot\t\t%q", want, got)
+	}
+	if Length("😀") != 2 {
+		t.Errorf("Expected surrogate pair length 2, got %d", Length("😀"))
+	}
+}
@@ -0,0 +1,114 @@
+package format
+
+import (
+	"strings"
+)
+
+// Length counts characters the way Telegram does, in UTF-16 code units
+func Length(text string) int {
+	length := 0
+	for _, r := range text {
+		if r >= 0x10000 {
+			length += 2
+		} else {
+			length++
+		}
+	}
+	return length
+}
+
+// Plain returns the text without markup and escaping
+func (b *Builder) Plain() string {
+	var builder strings.Builder
+	for _, s := range b.segments {
+		builder.WriteString(s.plain)
+	}
+	return builder.String()
+}
+
+// Split renders the text into parts not longer than limit. Parts are cut
+// between entities; an entity longer than the limit is split into several
+// entities of the same kind, preferably on line breaks or spaces
+func (b *Builder) Split(limit int) []string {
+	var parts []string
+	var current strings.Builder
+	currentLength := 0
+	flush := func() {
+		if currentLength > 0 {
+			parts = append(parts, current.String())
+			current.Reset()
+			currentLength = 0
+		}
+	}
+
+	for _, s := range b.segments {
+		rendered := s.String()
+		length := Length(rendered)
+		if currentLength+length > limit {
+			flush()
+		}
+		if length <= limit {
+			current.WriteString(rendered)
+			currentLength += length
+			continue
+		}
+
+		pieces := splitPlain(s.plain, limit-Length(s.open)-Length(s.close), s.escape)
+		for i, piece := range pieces {
+			rendered := segment{plain: piece, open: s.open, close: s.close, escape: s.escape}.String()
+			if i < len(pieces)-1 {
+				parts = append(parts, rendered)
+			} else {
+				current.WriteString(rendered)
+				currentLength = Length(rendered)
+			}
+		}
+	}
+	flush()
+	return parts
+}
+
+// SplitText splits a text without markup into parts not longer than limit
+func SplitText(text string, limit int) []string {
+	return splitPlain(text, limit, func(s string) string { return s })
+}
+
+// splitPlain cuts text into pieces which are not longer than budget once
+// escaped
+func splitPlain(text string, budget int, escape func(string) string) []string {
+	var pieces []string
+	runes := []rune(text)
+	for len(runes) > 0 {
+		cut, length := len(runes), 0
+		for i, r := range runes {
+			length += Length(escape(string(r)))
+			if length > budget {
+				cut = i
+				break
+			}
+		}
+		if cut < len(runes) {
+			if i := lastIndex(runes[:cut], '\n'); i > 0 {
+				cut = i + 1
+			} else if i := lastIndex(runes[:cut], ' '); i > 0 {
+				cut = i + 1
+			}
+		}
+		// Budget is smaller than a single escaped character
+		if cut == 0 {
+			cut = 1
+		}
+		pieces = append(pieces, string(runes[:cut]))
+		runes = runes[cut:]
+	}
+	return pieces
+}
+
+func lastIndex(runes []rune, r rune) int {
+	for i := len(runes) - 1; i >= 0; i-- {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
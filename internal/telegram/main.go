@@ -2,40 +2,50 @@ package telegram
 
 import (
 	"context"
-	"fmt"
 	"errors"
-	"io"
+	"fmt"
 	"net/http"
-	"net/url"
-	"strconv"
 	"strings"
 
 	"TeleBotNotifications/internal/config"
+	"TeleBotNotifications/internal/telegram/format"
 	// "TeleBotNotifications/internal/logger"
 )
 
 var apiURL = "https://api.telegram.org"
 
 type Bot struct {
-	token       string
-	commands    []command
-	callbacks   []callback
-	http_client *http.Client
-	timeout     int
-	ChatId      int
-	lastUpdate  int
+	token     string
+	commands  []command
+	callbacks []callback
+	// Handler of shared locations, they are ignored while it is nil
+	locationHandler CommandHandler
+	middlewares     []Middleware
+	dispatcher      *dispatcher
+	sender          *sender
+	http_client     *http.Client
+	timeout         int
+	ChatId          int
+	lastUpdate      int
 }
 
 func NewBot(config *config.TelegramConfig) Bot {
+	client := &http.Client{}
 	return Bot{
-		token:       config.BotToken,
-		http_client: &http.Client{},
+		token:      config.BotToken,
+		dispatcher: newDispatcher(config.Workers),
+		sender: newSender(config.SendAttempts, func(ctx context.Context, message BotMessage) (*Message, error) {
+			return sendMessage(ctx, client, config.BotToken, message)
+		}),
+		http_client: client,
 		timeout:     config.Timeout,
 		ChatId:      config.ChatId,
 		lastUpdate:  0,
 	}
 }
 
+// HandleUpdates fetches updates and passes them to the dispatcher. An update
+// is acknowledged by the next fetch only once the dispatcher accepted it
 func (b *Bot) HandleUpdates(ctx context.Context) error {
 	updates, err := b.getNewUpdates(ctx)
 	if err != nil {
@@ -50,104 +60,176 @@ func (b *Bot) HandleUpdates(ctx context.Context) error {
 		case <-ctx.Done():
 			return context.Canceled
 		default:
-			if update.Id > b.lastUpdate {
-				b.lastUpdate = update.Id
-			}
 			if update.Message != nil {
-				if !strings.HasPrefix(update.Message.Text, "/") {
-					continue
+				m := update.Message
+				if m.Location != nil && b.locationHandler != nil {
+					err = b.dispatcher.dispatch(ctx, m.Chat.Id, func() { b.handleLocation(m) })
+				} else if strings.HasPrefix(m.Text, "/") {
+					err = b.dispatcher.dispatch(ctx, m.Chat.Id, func() { b.handleCommand(m) })
 				}
-				go b.handleCommand(update.Message)
 			} else if update.CallbackQuery != nil {
-				go b.handleCallback(update.CallbackQuery)
+				c := update.CallbackQuery
+				chatId := c.From.Id
+				if c.Message != nil {
+					chatId = c.Message.Chat.Id
+				}
+				err = b.dispatcher.dispatch(ctx, chatId, func() { b.handleCallback(c) })
+			}
+			if err != nil {
+				return err
+			}
+			if update.Id > b.lastUpdate {
+				b.lastUpdate = update.Id
 			}
 		}
 	}
 	return nil
 }
 
+// https://core.telegram.org/bots/api#sendmessage
 type BotMessage struct {
-	chatId                int
-	Text                  string
-	ParseMode             *string
-	DisableWebPagePreview *bool
-	DisableNotification   *bool
-	ProtectContent        *bool
-	ReplyMarkup           *string
-}
-
-func (m *BotMessage) BuildURL(token string) string {
-	resource := fmt.Sprintf("/bot%s/sendMessage", token)
-	params := url.Values{
-		"chat_id": {strconv.Itoa(m.chatId)},
-		"text":    {m.Text},
+	ChatId                int                   `json:"chat_id"`
+	Text                  string                `json:"text"`
+	ParseMode             *string               `json:"parse_mode,omitempty"`
+	DisableWebPagePreview *bool                 `json:"disable_web_page_preview,omitempty"`
+	DisableNotification   *bool                 `json:"disable_notification,omitempty"`
+	ProtectContent        *bool                 `json:"protect_content,omitempty"`
+	ReplyMarkup           *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+// FormattedMessage creates a message with the text and parse mode of the builder
+func FormattedMessage(text *format.Builder) BotMessage {
+	parseMode := string(text.Mode())
+	return BotMessage{
+		Text:      text.String(),
+		ParseMode: &parseMode,
 	}
-	if m.ParseMode != nil {
-		params.Add("parse_mode", *m.ParseMode)
+}
+
+// https://core.telegram.org/bots/api#sendmessage
+const MaxMessageLength = 4096
+
+// SendText sends a text split into several messages if it exceeds the length
+// limit. Reply markup is attached to the last message
+func (b *Bot) SendText(text *format.Builder, replyMarkup *InlineKeyboardMarkup) ([]*Message, error) {
+	parseMode := string(text.Mode())
+	parts := text.Split(MaxMessageLength)
+
+	results := make([]<-chan SendResult, 0, len(parts))
+	for i, part := range parts {
+		message := BotMessage{Text: part, ParseMode: &parseMode}
+		if i == len(parts)-1 {
+			message.ReplyMarkup = replyMarkup
+		}
+		results = append(results, b.Send(message))
 	}
-	if m.DisableWebPagePreview != nil {
-		params.Add("disable_web_page_preview", strconv.FormatBool(*m.DisableWebPagePreview))
+
+	sent := make([]*Message, 0, len(parts))
+	var errs []error
+	for _, result := range results {
+		delivered := <-result
+		if delivered.Err != nil {
+			errs = append(errs, delivered.Err)
+			continue
+		}
+		sent = append(sent, delivered.Message)
 	}
-	if m.DisableNotification != nil {
-		params.Add("disable_notification", strconv.FormatBool(*m.DisableNotification))
+	return sent, errors.Join(errs...)
+}
+
+// SendTextOrDocument sends the text as messages, or as a text file attachment
+// if it takes more than maxMessages messages
+func (b *Bot) SendTextOrDocument(text *format.Builder, fileName string, maxMessages int) error {
+	if len(text.Split(MaxMessageLength)) <= maxMessages {
+		_, err := b.SendText(text, nil)
+		return err
 	}
-	if m.ProtectContent != nil {
-		params.Add("protect_content", strconv.FormatBool(*m.ProtectContent))
+	_, err := b.SendDocument(Document{
+		FileName: fileName,
+		Content:  []byte(text.Plain()),
+	})
+	return err
+}
+
+// EditedMessage replaces text and keyboard of a sent message
+// https://core.telegram.org/bots/api#editmessagetext
+type EditedMessage struct {
+	ChatId                int                   `json:"chat_id"`
+	MessageId             int                   `json:"message_id"`
+	Text                  string                `json:"text"`
+	ParseMode             *string               `json:"parse_mode,omitempty"`
+	DisableWebPagePreview *bool                 `json:"disable_web_page_preview,omitempty"`
+	ReplyMarkup           *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+func (b *Bot) EditMessageText(message EditedMessage) (*Message, error) {
+	if message.ChatId == 0 {
+		message.ChatId = b.ChatId
 	}
-	if m.ReplyMarkup != nil {
-		params.Add("reply_markup", *m.ReplyMarkup)
+	edited := &Message{}
+	err := b.call(context.Background(), "editMessageText", message, edited)
+	if err != nil {
+		return nil, err
 	}
-
-	u, _ := url.ParseRequestURI(apiURL)
-	u.Path = resource
-	u.RawQuery = params.Encode()
-	return u.String()
+	return edited, nil
 }
 
-func (b *Bot) SendMessage(message BotMessage) error {
-	message.chatId = b.ChatId
-	url := message.BuildURL(b.token)
-	response, err := http.Get(url)
+// https://core.telegram.org/bots/api#getme
+func (b *Bot) GetMe(ctx context.Context) (*User, error) {
+	me := &User{}
+	err := b.call(ctx, "getMe", struct{}{}, me)
 	if err != nil {
-		return fmt.Errorf("sending request failed with err: %s", err)
+		return nil, err
 	}
-	defer response.Body.Close()
+	return me, nil
+}
 
-	if response.StatusCode != http.StatusOK {
-		body, err := io.ReadAll(response.Body)
-		if err != nil {
-			return fmt.Errorf("unexpected status code: %s", response.Status)
-		}
-		return fmt.Errorf("status code: %s, error: %s", response.Status, body)
+func (b *Bot) DeleteMessage(chatId, messageId int) error {
+	params := map[string]int{
+		"chat_id":    chatId,
+		"message_id": messageId,
 	}
+	return b.call(context.Background(), "deleteMessage", params, nil)
+}
 
-	return nil
+func (b *Bot) PinChatMessage(chatId, messageId int, disableNotification bool) error {
+	params := map[string]interface{}{
+		"chat_id":              chatId,
+		"message_id":           messageId,
+		"disable_notification": disableNotification,
+	}
+	return b.call(context.Background(), "pinChatMessage", params, nil)
 }
 
+// Write sends p as a preformatted block, so logs keep their layout. Text not
+// fitting into one message is sent as a file
 func (b *Bot) Write(p []byte) (n int, err error) {
-	err = b.SendMessage(BotMessage{Text: string(p)})
+	err = b.SendTextOrDocument(format.New(format.HTML).Pre(string(p), ""), "log.txt", 1)
 	if err != nil {
 		return 0, err
 	}
 	return len(p), nil
 }
 
-// );
-func ButtonRow(buttons ...string) *string {
-	row := "{\"inline_keyboard\": [["
-	for i, button := range buttons {
-		if i != 0 {
-			row = row + ","
-		}
-		row = row + button
-	}
-	row = row + "]]}"
-	return &row
+// https://core.telegram.org/bots/api#inlinekeyboardbutton
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	Url          string `json:"url,omitempty"`
+	CallbackData string `json:"callback_data,omitempty"`
 }
 
-func CallbackButton(text, data string) string {
-	return fmt.Sprintf("{\"text\": \"%s\",\"callback_data\": \"%s\"}", text, data)
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
 }
-func URLButton(text, url string) string {
-	return fmt.Sprintf("{\"text\": \"%s\",\"url\": \"%s\"}", text, url)
+
+func ButtonRow(buttons ...InlineKeyboardButton) *InlineKeyboardMarkup {
+	return &InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{buttons}}
+}
+
+func CallbackButton(text, data string) InlineKeyboardButton {
+	return InlineKeyboardButton{Text: text, CallbackData: data}
+}
+
+func URLButton(text, url string) InlineKeyboardButton {
+	return InlineKeyboardButton{Text: text, Url: url}
 }
@@ -0,0 +1,37 @@
+package telegram
+
+import (
+	"errors"
+	"strconv"
+
+	"TeleBotNotifications/internal/metrics"
+)
+
+var (
+	apiRequestsTotal = metrics.NewCounterVec("telegram_api_requests_total",
+		"Bot API requests by method and result.", "method", "result")
+	apiRequestDuration = metrics.NewHistogramVec("telegram_api_request_duration_seconds",
+		"Bot API request latency, getUpdates includes long polling.", metrics.DefaultBuckets, "method")
+	messagesSentTotal = metrics.NewCounterVec("telegram_messages_sent_total",
+		"Queued messages by delivery result: delivered, failed or dropped after the last attempt.", "result")
+	sendRetriesTotal = metrics.NewCounterVec("telegram_send_retries_total",
+		"Message sending attempts repeated after temporary failures.")
+	handlerRequestsTotal = metrics.NewCounterVec("telegram_handler_requests_total",
+		"Handled commands and callbacks by keyword.", "keyword")
+	handlerErrorsTotal = metrics.NewCounterVec("telegram_handler_errors_total",
+		"Commands and callbacks which returned an error.", "keyword")
+	handlerDuration = metrics.NewHistogramVec("telegram_handler_duration_seconds",
+		"Command and callback handling time.", metrics.DefaultBuckets, "keyword")
+)
+
+// resultLabel labels an API call by its error code
+func resultLabel(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	var apiError *APIError
+	if errors.As(err, &apiError) {
+		return strconv.Itoa(apiError.Code)
+	}
+	return "error"
+}
@@ -0,0 +1,174 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Request describes a command or a callback passed through middlewares
+type Request struct {
+	UserId   int
+	ChatId   int
+	Keyword  string
+	Callback bool
+}
+
+type HandlerFunc func(Request) error
+
+type Middleware func(HandlerFunc) HandlerFunc
+
+// Use adds middlewares wrapping every command and callback handler. The first
+// added middleware is the outermost one
+func (b *Bot) Use(middlewares ...Middleware) {
+	b.middlewares = append(b.middlewares, middlewares...)
+}
+
+func (b *Bot) wrap(handler HandlerFunc) HandlerFunc {
+	for i := len(b.middlewares) - 1; i >= 0; i-- {
+		handler = b.middlewares[i](handler)
+	}
+	return handler
+}
+
+// UserError carries a message that is safe to show to the user. Other errors
+// are reported with a generic message
+type UserError struct {
+	Message string
+}
+
+func (e *UserError) Error() string {
+	return e.Message
+}
+
+func NewUserError(format string, a ...interface{}) error {
+	return &UserError{Message: fmt.Sprintf(format, a...)}
+}
+
+var ErrUnauthorized = &UserError{Message: "You are not allowed to use this bot"}
+var ErrRateLimited = &UserError{Message: "Too many requests, try again later"}
+
+// errorText returns the text reported to the user for a failed handler
+func errorText(err error) string {
+	var userError *UserError
+	if errors.As(err, &userError) {
+		return userError.Message
+	}
+	return "Something went wrong"
+}
+
+// Recover converts a panic in a handler into an error
+func Recover(log *slog.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(r Request) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					log.Error("panic in handler", "keyword", r.Keyword, "user_id", r.UserId, "panic", p, "stack", string(debug.Stack()))
+					err = fmt.Errorf("panic: %v", p)
+				}
+			}()
+			return next(r)
+		}
+	}
+}
+
+func Logging(log *slog.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(r Request) error {
+			start := time.Now()
+			err := next(r)
+			attrs := []any{"keyword", r.Keyword, "user_id", r.UserId, "chat_id", r.ChatId, "duration", time.Since(start)}
+			var userError *UserError
+			switch {
+			case errors.As(err, &userError):
+				log.Info("request rejected", append(attrs, "reason", err)...)
+			case err != nil:
+				log.Error("request failed", append(attrs, "error", err)...)
+			default:
+				log.Info("request handled", attrs...)
+			}
+			return err
+		}
+	}
+}
+
+// Auth rejects requests for which allowed returns false
+func Auth(allowed func(Request) bool) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(r Request) error {
+			if !allowed(r) {
+				return ErrUnauthorized
+			}
+			return next(r)
+		}
+	}
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// rateLimiter counts requests of users in fixed windows. Expired windows are
+// removed once an interval, so users seen long ago don't take memory
+type rateLimiter struct {
+	mu       sync.Mutex
+	limit    int
+	interval time.Duration
+	windows  map[int]*rateWindow
+	swept    time.Time
+}
+
+func (l *rateLimiter) allow(userId int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) >= l.interval {
+		for id, w := range l.windows {
+			if now.Sub(w.start) >= l.interval {
+				delete(l.windows, id)
+			}
+		}
+		l.swept = now
+	}
+
+	w, ok := l.windows[userId]
+	if !ok || now.Sub(w.start) >= l.interval {
+		w = &rateWindow{start: now}
+		l.windows[userId] = w
+	}
+	w.count++
+	return w.count <= l.limit
+}
+
+// RateLimit allows every user at most limit requests per interval
+func RateLimit(limit int, interval time.Duration) Middleware {
+	limiter := &rateLimiter{limit: limit, interval: interval, windows: make(map[int]*rateWindow)}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(r Request) error {
+			if !limiter.allow(r.UserId, time.Now()) {
+				return ErrRateLimited
+			}
+			return next(r)
+		}
+	}
+}
+
+// Metrics counts requests, errors and handling time per keyword
+func Metrics() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(r Request) error {
+			start := time.Now()
+			err := next(r)
+			handlerDuration.Observe(time.Since(start).Seconds(), r.Keyword)
+			handlerRequestsTotal.Inc(r.Keyword)
+			if err != nil {
+				handlerErrorsTotal.Inc(r.Keyword)
+			}
+			return err
+		}
+	}
+}
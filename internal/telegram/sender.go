@@ -0,0 +1,271 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this
+const globalSendInterval = time.Second / 30
+const chatSendInterval = time.Second
+const groupSendInterval = time.Minute / 20
+
+const defaultSendAttempts = 5
+const sendQueueSize = 256
+const maxRetryBackoff = time.Minute
+
+// A hung request fails after this time instead of holding up the queue
+const sendTimeout = 30 * time.Second
+
+var ErrBotStopped = errors.New("telegram bot is stopped")
+
+// SendResult is the delivery result of a queued message. Messages given up
+// after the last attempt get the error of that attempt
+type SendResult struct {
+	Message  *Message
+	Attempts int
+	Err      error
+}
+
+// outgoingMessage is a message or a document to the chat, deliver makes one
+// attempt to send it
+type outgoingMessage struct {
+	chatId  int
+	deliver func(context.Context) (*Message, error)
+	result  chan SendResult
+}
+
+// queuedMessage is a message waiting for its first or next attempt
+type queuedMessage struct {
+	outgoingMessage
+	attempts  int
+	backoff   time.Duration
+	notBefore time.Time
+}
+
+// sender delivers queued messages one by one, keeping global and per chat
+// intervals between them and retrying temporary failures. A message waiting
+// for a retry holds up later messages of its chat only. After the last
+// attempt the message is dropped, which is logged and counted. The queue is
+// kept in memory, so messages not sent yet are lost on restart
+type sender struct {
+	queue          chan outgoingMessage
+	deliver        func(context.Context, BotMessage) (*Message, error)
+	maxAttempts    int
+	timeout        time.Duration
+	globalInterval time.Duration
+	chatInterval   time.Duration
+	groupInterval  time.Duration
+	lastSent       time.Time
+	lastChat       map[int]time.Time
+	mu             sync.RWMutex
+	closed         bool
+	done           chan struct{}
+}
+
+func newSender(maxAttempts int, deliver func(context.Context, BotMessage) (*Message, error)) *sender {
+	if maxAttempts < 1 {
+		maxAttempts = defaultSendAttempts
+	}
+	s := &sender{
+		queue:          make(chan outgoingMessage, sendQueueSize),
+		deliver:        deliver,
+		maxAttempts:    maxAttempts,
+		timeout:        sendTimeout,
+		globalInterval: globalSendInterval,
+		chatInterval:   chatSendInterval,
+		groupInterval:  groupSendInterval,
+		lastChat:       make(map[int]time.Time),
+		done:           make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// run sends the message that is ready first and takes new ones from the
+// queue while waiting. It returns once the queue is closed and every message
+// got its result
+func (s *sender) run() {
+	defer close(s.done)
+	var pending []*queuedMessage
+	queue := s.queue
+	for queue != nil || len(pending) > 0 {
+		var timer *time.Timer
+		var wake <-chan time.Time
+		if index, at := s.next(pending); index >= 0 {
+			delay := time.Until(at)
+			if delay <= 0 {
+				s.prune(time.Now())
+				if s.send(pending[index]) {
+					pending = append(pending[:index], pending[index+1:]...)
+				}
+				continue
+			}
+			timer = time.NewTimer(delay)
+			wake = timer.C
+		}
+
+		select {
+		case outgoing, ok := <-queue:
+			if !ok {
+				queue = nil
+				continue
+			}
+			pending = append(pending, &queuedMessage{outgoingMessage: outgoing, backoff: time.Second})
+		case <-wake:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// next returns the pending message which can be sent first and the time it
+// can be sent at. Only the oldest message of every chat is taken, so messages
+// of a chat keep their order
+func (s *sender) next(pending []*queuedMessage) (int, time.Time) {
+	index, first := -1, time.Time{}
+	seen := make(map[int]bool)
+	for i, m := range pending {
+		chatId := m.chatId
+		if seen[chatId] {
+			continue
+		}
+		seen[chatId] = true
+		if at := s.readyAt(m); index < 0 || at.Before(first) {
+			index, first = i, at
+		}
+	}
+	return index, first
+}
+
+// prune forgets chats whose last message doesn't limit the next one anymore
+func (s *sender) prune(now time.Time) {
+	interval := s.chatInterval
+	if s.groupInterval > interval {
+		interval = s.groupInterval
+	}
+	for chatId, last := range s.lastChat {
+		if now.Sub(last) >= interval {
+			delete(s.lastChat, chatId)
+		}
+	}
+}
+
+// readyAt returns the time sending the message doesn't exceed the rate limits
+// and its retry delay is over
+func (s *sender) readyAt(m *queuedMessage) time.Time {
+	next := s.lastSent.Add(s.globalInterval)
+	interval := s.chatInterval
+	if m.chatId < 0 {
+		interval = s.groupInterval
+	}
+	if chatNext := s.lastChat[m.chatId].Add(interval); chatNext.After(next) {
+		next = chatNext
+	}
+	if m.notBefore.After(next) {
+		next = m.notBefore
+	}
+	return next
+}
+
+// send makes an attempt and reports whether the message is done. Temporary
+// failures are retried after retry_after or the backoff
+func (s *sender) send(m *queuedMessage) bool {
+	m.attempts++
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	sent, err := m.deliver(ctx)
+	cancel()
+	s.lastSent = time.Now()
+	s.lastChat[m.chatId] = s.lastSent
+	if err == nil || !temporary(err) || m.attempts == s.maxAttempts {
+		switch {
+		case err == nil:
+			messagesSentTotal.Inc("delivered")
+		case temporary(err):
+			messagesSentTotal.Inc("dropped")
+			slog.Warn("message dropped after the last attempt", "chat_id", m.chatId, "attempts", m.attempts, "error", err)
+		default:
+			messagesSentTotal.Inc("failed")
+		}
+		m.result <- SendResult{Message: sent, Attempts: m.attempts, Err: err}
+		return true
+	}
+	sendRetriesTotal.Inc()
+
+	var apiError *APIError
+	if errors.As(err, &apiError) && apiError.RetryAfter > 0 {
+		m.notBefore = s.lastSent.Add(apiError.RetryAfter)
+		return false
+	}
+	m.notBefore = s.lastSent.Add(m.backoff)
+	m.backoff *= 2
+	if m.backoff > maxRetryBackoff {
+		m.backoff = maxRetryBackoff
+	}
+	return false
+}
+
+func (s *sender) enqueue(message BotMessage) <-chan SendResult {
+	return s.enqueueFunc(message.ChatId, func(ctx context.Context) (*Message, error) {
+		return s.deliver(ctx, message)
+	})
+}
+
+// enqueueFunc queues a delivery to the chat, which keeps the rate limits and
+// retries of messages
+func (s *sender) enqueueFunc(chatId int, deliver func(context.Context) (*Message, error)) <-chan SendResult {
+	result := make(chan SendResult, 1)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		result <- SendResult{Err: ErrBotStopped}
+		return result
+	}
+	s.queue <- outgoingMessage{chatId: chatId, deliver: deliver, result: result}
+	return result
+}
+
+// stop waits until every queued message is delivered
+func (s *sender) stop() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	<-s.done
+}
+
+// Send queues the message and returns a channel receiving the delivery result
+func (b *Bot) Send(message BotMessage) <-chan SendResult {
+	if message.ChatId == 0 {
+		message.ChatId = b.ChatId
+	}
+	return b.sender.enqueue(message)
+}
+
+// SendMessage queues the message and waits until it is delivered
+func (b *Bot) SendMessage(message BotMessage) (*Message, error) {
+	result := <-b.Send(message)
+	return result.Message, result.Err
+}
+
+func sendMessage(ctx context.Context, client *http.Client, token string, message BotMessage) (*Message, error) {
+	sent := &Message{}
+	err := call(ctx, client, token, "sendMessage", message, sent)
+	if err != nil {
+		return nil, err
+	}
+	return sent, nil
+}
+
+// StopSender delivers queued messages and rejects new ones
+func (b *Bot) StopSender() {
+	b.sender.stop()
+}
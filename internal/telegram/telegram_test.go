@@ -1 +1,509 @@
-package telegram
\ No newline at end of file
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_middlewareOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(r Request) error {
+				calls = append(calls, name)
+				return next(r)
+			}
+		}
+	}
+
+	bot := &Bot{}
+	bot.Use(record("first"), record("second"))
+	err := bot.wrap(func(Request) error {
+		calls = append(calls, "handler")
+		return nil
+	})(Request{})
+
+	if err != nil {
+		t.Error(err)
+	}
+	expected := []string{"first", "second", "handler"}
+	if len(calls) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, calls)
+		}
+	}
+}
+
+func Test_Recover(t *testing.T) {
+	handler := Recover(slog.New(slog.NewTextHandler(io.Discard, nil)))(func(Request) error {
+		panic("boom")
+	})
+	err := handler(Request{Keyword: "/test"})
+	if err == nil {
+		t.Error("Error expected")
+	}
+	if errorText(err) != "Something went wrong" {
+		t.Errorf("Internal error leaked to user: %s", errorText(err))
+	}
+}
+
+func Test_RateLimit(t *testing.T) {
+	handler := RateLimit(2, time.Hour)(func(Request) error { return nil })
+
+	for i := 0; i < 2; i++ {
+		if err := handler(Request{UserId: 1}); err != nil {
+			t.Errorf("Request %d: unexpected error %v", i, err)
+		}
+	}
+	if err := handler(Request{UserId: 1}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected %v, got %v", ErrRateLimited, err)
+	}
+	if err := handler(Request{UserId: 2}); err != nil {
+		t.Errorf("Other user is limited: %v", err)
+	}
+}
+
+func Test_rateLimiterEviction(t *testing.T) {
+	limiter := &rateLimiter{limit: 1, interval: time.Minute, windows: make(map[int]*rateWindow)}
+	now := time.Now()
+	for userId := 1; userId <= 3; userId++ {
+		limiter.allow(userId, now)
+	}
+	now = now.Add(time.Minute)
+	if !limiter.allow(4, now) {
+		t.Errorf("New user is limited")
+	}
+	if len(limiter.windows) != 1 {
+		t.Errorf("Expected expired windows to be removed, got %d windows", len(limiter.windows))
+	}
+}
+
+func Test_errorText(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "UserError",
+			err:  NewUserError("Wrong parameter %d", 1),
+			want: "Wrong parameter 1",
+		},
+		{
+			name: "WrappedUserError",
+			err:  errors.Join(errors.New("context"), ErrUnauthorized),
+			want: ErrUnauthorized.Message,
+		},
+		{
+			name: "InternalError",
+			err:  errors.New("token=secret"),
+			want: "Something went wrong",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorText(tt.err); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_dispatcherOrder(t *testing.T) {
+	d := newDispatcher(3)
+	var wg sync.WaitGroup
+	d.start(&wg)
+
+	var mu sync.Mutex
+	handled := make(map[int][]int)
+	for i := 0; i < 50; i++ {
+		for chatId := 1; chatId <= 5; chatId++ {
+			i, chatId := i, chatId
+			err := d.dispatch(context.Background(), chatId, func() {
+				mu.Lock()
+				handled[chatId] = append(handled[chatId], i)
+				mu.Unlock()
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	d.stop()
+	wg.Wait()
+
+	for chatId, order := range handled {
+		if len(order) != 50 {
+			t.Errorf("Chat %d: expected 50 updates, got %d", chatId, len(order))
+		}
+		for i := range order {
+			if order[i] != i {
+				t.Errorf("Chat %d: updates out of order %v", chatId, order)
+				break
+			}
+		}
+	}
+}
+
+func Test_dispatcherRecover(t *testing.T) {
+	d := newDispatcher(1)
+	var wg sync.WaitGroup
+	d.start(&wg)
+
+	done := false
+	d.dispatch(context.Background(), 1, func() { panic("boom") })
+	d.dispatch(context.Background(), 1, func() { done = true })
+	d.stop()
+	wg.Wait()
+
+	if !done {
+		t.Error("Worker stopped after panic")
+	}
+	if err := d.dispatch(context.Background(), 1, func() {}); !errors.Is(err, errDispatcherStopped) {
+		t.Errorf("Dispatch after stop returned %v", err)
+	}
+}
+
+func Test_HandleUpdatesOffset(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok": true, "result": [{"update_id": 5, "message": {"message_id": 1, "text": "/start", "chat": {"id": 7}}}]}`))
+	}))
+	defer server.Close()
+	defaultURL := apiURL
+	apiURL = server.URL
+	defer func() { apiURL = defaultURL }()
+
+	bot := &Bot{token: "token", http_client: server.Client(), dispatcher: newDispatcher(1)}
+	bot.StopDispatcher()
+	if err := bot.HandleUpdates(context.Background()); !errors.Is(err, errDispatcherStopped) {
+		t.Errorf("Expected %v, got %v", errDispatcherStopped, err)
+	}
+	if bot.lastUpdate != 0 {
+		t.Errorf("Refused update is acknowledged, offset %d", bot.lastUpdate)
+	}
+
+	var wg sync.WaitGroup
+	bot.dispatcher = newDispatcher(1)
+	bot.StartDispatcher(&wg)
+	if err := bot.HandleUpdates(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	bot.StopDispatcher()
+	wg.Wait()
+	if bot.lastUpdate != 5 {
+		t.Errorf("Expected offset 5 after dispatch, got %d", bot.lastUpdate)
+	}
+}
+
+func Test_senderRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		errors       []error
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "OK",
+			errors:       []error{nil},
+			wantAttempts: 1,
+		},
+		{
+			name: "RetryAfter",
+			errors: []error{
+				&APIError{Code: http.StatusTooManyRequests, RetryAfter: time.Millisecond},
+				nil,
+			},
+			wantAttempts: 2,
+		},
+		{
+			name: "PermanentError",
+			errors: []error{
+				&APIError{Code: http.StatusBadRequest, Description: "Bad Request: can't parse entities"},
+				nil,
+			},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name: "TooManyAttempts",
+			errors: []error{
+				&APIError{Code: http.StatusTooManyRequests, RetryAfter: time.Millisecond},
+				&APIError{Code: http.StatusTooManyRequests, RetryAfter: time.Millisecond},
+				&APIError{Code: http.StatusTooManyRequests, RetryAfter: time.Millisecond},
+			},
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			s := newSender(3, func(context.Context, BotMessage) (*Message, error) {
+				err := tt.errors[calls]
+				calls++
+				if err != nil {
+					return nil, err
+				}
+				return &Message{MessageId: calls}, nil
+			})
+			s.chatInterval = 0
+			s.globalInterval = 0
+
+			result := <-s.enqueue(BotMessage{Text: "text", ChatId: 1})
+			s.stop()
+
+			if result.Attempts != tt.wantAttempts {
+				t.Errorf("Expected %d attempts, got %d", tt.wantAttempts, result.Attempts)
+			}
+			if (result.Err != nil) != tt.wantErr {
+				t.Errorf("Unexpected result error: %v", result.Err)
+			}
+			if result.Err == nil && result.Message.MessageId != tt.wantAttempts {
+				t.Errorf("Expected message from attempt %d, got %+v", tt.wantAttempts, result.Message)
+			}
+			if err := (<-s.enqueue(BotMessage{})).Err; !errors.Is(err, ErrBotStopped) {
+				t.Errorf("Expected %v after stop, got %v", ErrBotStopped, err)
+			}
+		})
+	}
+}
+
+func Test_senderRetryOtherChats(t *testing.T) {
+	var mu sync.Mutex
+	var delivered []string
+	retried := false
+	s := newSender(3, func(_ context.Context, message BotMessage) (*Message, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if message.Text == "first" && !retried {
+			retried = true
+			return nil, &APIError{Code: http.StatusTooManyRequests, RetryAfter: 200 * time.Millisecond}
+		}
+		delivered = append(delivered, message.Text)
+		return &Message{}, nil
+	})
+	s.chatInterval = 0
+	s.globalInterval = 0
+
+	first := s.enqueue(BotMessage{Text: "first", ChatId: 1})
+	second := s.enqueue(BotMessage{Text: "second", ChatId: 1})
+	other := s.enqueue(BotMessage{Text: "other", ChatId: 2})
+	select {
+	case result := <-other:
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Message to another chat waits for the retry")
+	}
+	for _, result := range []SendResult{<-first, <-second} {
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+	}
+	s.stop()
+
+	// Messages of the retried chat keep their order
+	if want := []string{"other", "first", "second"}; !reflect.DeepEqual(delivered, want) {
+		t.Errorf("Expected delivery order %v, got %v", want, delivered)
+	}
+}
+
+func Test_senderTimeout(t *testing.T) {
+	s := newSender(1, func(ctx context.Context, message BotMessage) (*Message, error) {
+		if message.Text == "hung" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return &Message{}, nil
+	})
+	s.timeout = 10 * time.Millisecond
+	s.chatInterval = 0
+	s.globalInterval = 0
+
+	hung := s.enqueue(BotMessage{Text: "hung", ChatId: 1})
+	other := s.enqueue(BotMessage{Text: "other", ChatId: 2})
+	select {
+	case result := <-other:
+		if result.Err != nil {
+			t.Errorf("Unexpected error %v", result.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Hung request holds up the queue")
+	}
+	if result := <-hung; !errors.Is(result.Err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline error, got %v", result.Err)
+	}
+	s.stop()
+}
+
+func Test_senderPrune(t *testing.T) {
+	s := &sender{chatInterval: time.Second, groupInterval: time.Minute, lastChat: make(map[int]time.Time)}
+	now := time.Now()
+	s.lastChat[1] = now.Add(-time.Hour)
+	s.lastChat[2] = now.Add(-time.Second)
+	s.lastChat[-3] = now.Add(-30 * time.Second)
+	s.prune(now)
+	if _, ok := s.lastChat[1]; ok || len(s.lastChat) != 2 {
+		t.Errorf("Expected only recent chats to be kept, got %v", s.lastChat)
+	}
+}
+
+func Test_decodeResponse(t *testing.T) {
+	type args struct {
+		statusCode int
+		response   string
+	}
+	tests := []struct {
+		name           string
+		args           args
+		wantMessage    Message
+		wantRetryAfter time.Duration
+		wantErr        bool
+	}{
+		{
+			name: "OK",
+			args: args{
+				statusCode: http.StatusOK,
+				response:   `{"ok": true, "result": {"message_id": 42, "chat": {"id": 7, "type": "private"}, "date": 1700000000, "text": "text"}}`,
+			},
+			wantMessage: Message{MessageId: 42, Chat: Chat{Id: 7, Type: "private"}, Date: 1700000000, Text: "text"},
+		},
+		{
+			name: "TooManyRequests",
+			args: args{
+				statusCode: http.StatusTooManyRequests,
+				response:   `{"ok": false, "error_code": 429, "description": "Too Many Requests: retry after 35", "parameters": {"retry_after": 35}}`,
+			},
+			wantRetryAfter: 35 * time.Second,
+			wantErr:        true,
+		},
+		{
+			name: "NotJson",
+			args: args{
+				statusCode: http.StatusBadGateway,
+				response:   "<html>Bad Gateway</html>",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockResponse := httptest.NewRecorder()
+			mockResponse.WriteHeader(tt.args.statusCode)
+			mockResponse.WriteString(tt.args.response)
+
+			message := Message{}
+			err := decodeResponse(mockResponse.Result(), &message)
+			if err != nil {
+				if !tt.wantErr {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				var apiError *APIError
+				if !errors.As(err, &apiError) {
+					t.Fatalf("Expected APIError, got %v", err)
+				}
+				if apiError.RetryAfter != tt.wantRetryAfter {
+					t.Errorf("Expected retry after %s, got %s", tt.wantRetryAfter, apiError.RetryAfter)
+				}
+				if !temporary(err) {
+					t.Errorf("Error %v is not considered temporary", err)
+				}
+				return
+			} else if tt.wantErr {
+				t.Fatal("Error expected")
+			}
+
+			if message != tt.wantMessage {
+				t.Errorf("Messages do not match. \nExpected: \t%+v, \nGot: \t%+v", tt.wantMessage, message)
+			}
+		})
+	}
+}
+
+func Test_sendMessage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/bottoken/sendMessage" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		body := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		markup, ok := body["reply_markup"].(map[string]interface{})
+		if body["text"] != `"quoted" & long` || !ok || markup["inline_keyboard"] == nil {
+			t.Errorf("Unexpected request body %v", body)
+		}
+		w.Write([]byte(`{"ok": true, "result": {"message_id": 42, "chat": {"id": 7}}}`))
+	}))
+	defer server.Close()
+	defaultURL := apiURL
+	apiURL = server.URL
+	defer func() { apiURL = defaultURL }()
+
+	sent, err := sendMessage(context.Background(), server.Client(), "token", BotMessage{
+		ChatId:      7,
+		Text:        `"quoted" & long`,
+		ReplyMarkup: ButtonRow(CallbackButton("Play", "/play spotify:album:1up")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.MessageId != 42 {
+		t.Errorf("Expected message id 42, got %d", sent.MessageId)
+	}
+}
+
+func Test_SendDocument(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Documents are retried by the queue like messages
+		calls++
+		if calls == 1 {
+			w.Write([]byte(`{"ok": false, "error_code": 429, "description": "Too Many Requests", "parameters": {"retry_after": 1}}`))
+			return
+		}
+		if r.URL.Path != "/bottoken/sendDocument" {
+			t.Errorf("Unexpected request path %s", r.URL.Path)
+		}
+		file, header, err := r.FormFile("document")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		content, _ := io.ReadAll(file)
+		if header.Filename != "log.txt" || string(content) != "long log" || r.FormValue("chat_id") != "7" {
+			t.Errorf("Unexpected document %s %q for chat %s", header.Filename, content, r.FormValue("chat_id"))
+		}
+		w.Write([]byte(`{"ok": true, "result": {"message_id": 43, "chat": {"id": 7}}}`))
+	}))
+	defer server.Close()
+	defaultURL := apiURL
+	apiURL = server.URL
+	defer func() { apiURL = defaultURL }()
+
+	bot := &Bot{token: "token", http_client: server.Client(), ChatId: 7, sender: newSender(2, nil)}
+	defer bot.StopSender()
+	sent, err := bot.SendDocument(Document{FileName: "log.txt", Content: []byte("long log")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.MessageId != 43 || calls != 2 {
+		t.Errorf("Expected message id 43 after 2 calls, got %d after %d", sent.MessageId, calls)
+	}
+}
@@ -1,16 +1,12 @@
 package telegram
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"net/url"
 	"context"
 	"errors"
-	"strconv"
+	"fmt"
 )
 
-type user struct {
+type User struct {
 	Id           int    `json:"id"`
 	IsBot        bool   `json:"is_bot"`
 	FirstName    string `json:"first_name"`
@@ -18,80 +14,75 @@ type user struct {
 	LanguageCode string `json:"language_code"`
 }
 
-type message struct {
-	MessageId int  `json:"message_id"`
-	From      user `json:"from"`
-	Chat      struct {
-		Id        int    `json:"id"`
-		FirstName string `json:"first_name"`
-		Username  string `json:"username"`
-		Type      string `json:"type"`
-	} `json:"chat"`
-	Date int    `json:"date"`
-	Text string `json:"text"`
+type Chat struct {
+	Id        int    `json:"id"`
+	FirstName string `json:"first_name"`
+	Username  string `json:"username"`
+	Type      string `json:"type"`
+}
+
+// https://core.telegram.org/bots/api#location
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// https://core.telegram.org/bots/api#message
+type Message struct {
+	MessageId int       `json:"message_id"`
+	From      *User     `json:"from"`
+	Chat      Chat      `json:"chat"`
+	Date      int       `json:"date"`
+	Text      string    `json:"text"`
+	Location  *Location `json:"location,omitempty"`
+}
+
+// userId returns the sender, which is empty for messages sent to channels
+func (m *Message) userId() int {
+	if m.From == nil {
+		return 0
+	}
+	return m.From.Id
 }
 
 type callbackQuery struct {
-	Id   string `json:"id"`
-	From user   `json:"from"`
-	// message
-	InlineMessageId *string `json:"inline_message_id"`
-	ChatInstance    string `json:"chat_instance"`
-	Data            *string `json:"data"`
-	GameShortName   *string `json:"game_short_name"`
+	Id              string   `json:"id"`
+	From            User     `json:"from"`
+	Message         *Message `json:"message"`
+	InlineMessageId *string  `json:"inline_message_id"`
+	ChatInstance    string   `json:"chat_instance"`
+	Data            *string  `json:"data"`
+	GameShortName   *string  `json:"game_short_name"`
 }
 
 type update struct {
 	Id            int            `json:"update_id"`
-	Message       *message       `json:"message"`
+	Message       *Message       `json:"message"`
 	CallbackQuery *callbackQuery `json:"callback_query"`
 }
 
-type updateResponse struct {
-	Ok     bool     `json:"ok"`
-	Result []update `json:"result"`
-}
-
-func (b *Bot) createUpdateUrl() string {
-	resource := fmt.Sprintf("/bot%s/getUpdates", b.token)
-	params := url.Values{
-		"offset":          {strconv.Itoa(b.lastUpdate + 1)},
-		"timeout":         {strconv.Itoa(b.timeout)},
-		"allowed_updates": {"[\"message\", \"callback_query\"]"},
-	}
-
-	u, _ := url.ParseRequestURI(apiURL)
-	u.Path = resource
-	u.RawQuery = params.Encode()
-	return u.String()
+type getUpdatesParams struct {
+	Offset         int      `json:"offset"`
+	Timeout        int      `json:"timeout"`
+	AllowedUpdates []string `json:"allowed_updates"`
 }
 
 // https://core.telegram.org/bots/api#getupdates
 func (b *Bot) getNewUpdates(ctx context.Context) ([]update, error) {
-	requestUrl := b.createUpdateUrl()
-    req, err := http.NewRequestWithContext(ctx, "GET", requestUrl, nil)
-    if err != nil {
-        return nil, fmt.Errorf("creating request failed with err: %s", err)
-    }
-
-    response, err := b.http_client.Do(req)
-    if err != nil {
-		if errors.Is(err, context.Canceled) {
-			return nil, fmt.Errorf("request was canceled: %w", err)
-		}
-        return nil, fmt.Errorf("sending request failed with err: %s", err)
-    }
-	defer response.Body.Close()
-
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %s", response.Status)
+	params := getUpdatesParams{
+		Offset:         b.lastUpdate + 1,
+		Timeout:        b.timeout,
+		AllowedUpdates: []string{"message", "callback_query"},
 	}
 
-	updates := &updateResponse{}
-	err = json.NewDecoder(response.Body).Decode(updates)
+	var updates []update
+	err := b.call(ctx, "getUpdates", params, &updates)
 	if err != nil {
-		return nil, fmt.Errorf("decoding as message failed with error: %s", err)
+		if errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("getting updates failed with err: %w", err)
 	}
 
-	return updates.Result, nil
+	return updates, nil
 }